@@ -12,4 +12,5 @@ require (
 require (
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/time v0.6.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,132 @@
+package benchmarks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/castai/logging/components"
+)
+
+// newIngestServer discards request bodies. With failFirst set, every first
+// attempt of a batch fails with 503 so the client retries once.
+func newIngestServer(b *testing.B, failFirst bool) *httptest.Server {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if failFirst && requests.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	b.Cleanup(server.Close)
+	return server
+}
+
+func newIngestClient(b *testing.B, url string, level components.CompressionLevel) *components.APIClientImpl {
+	client, err := components.NewAPIClient(components.Config{
+		APIBaseURL:          url,
+		APIKey:              "key",
+		ClusterID:           "cluster",
+		Component:           "bench",
+		Version:             "v1",
+		CompressionLevel:    level,
+		MaxRetryBackoffWait: time.Nanosecond,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return client
+}
+
+func ingestEntries(n int) []components.Entry {
+	entries := make([]components.Entry, n)
+	for i := range entries {
+		entries[i] = components.Entry{
+			Level:   string(components.LogLevelInfo),
+			Message: fmt.Sprintf("request %d handled", i),
+			Time:    time.Now(),
+			Fields: map[string]string{
+				"user_id":    "u-123",
+				"request_id": fmt.Sprintf("req-%d", i),
+				"region":     "eu-west-1",
+			},
+		}
+	}
+	return entries
+}
+
+// naiveIngest is the previous implementation: marshal the batch, then
+// allocate a new buffer and gzip writer for every attempt.
+func naiveIngest(url string, entries []components.Entry, attempts int) error {
+	jsonBytes, err := json.Marshal(&components.IngestLogsRequest{Version: "v1", Entries: entries})
+	if err != nil {
+		return err
+	}
+	for range attempts {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		if _, err := gzipWriter.Write(jsonBytes); err != nil {
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+		resp, err := http.Post(url, "application/json", &buf)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+	}
+	return nil
+}
+
+func BenchmarkIngestLogs(b *testing.B) {
+	for _, size := range []int{100, 1000} {
+		entries := ingestEntries(size)
+		for _, retry := range []bool{false, true} {
+			attempts := 1
+			if retry {
+				attempts = 2
+			}
+			name := fmt.Sprintf("entries=%d/attempts=%d", size, attempts)
+
+			b.Run(name+"/naive", func(b *testing.B) {
+				server := newIngestServer(b, false)
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := naiveIngest(server.URL, entries, attempts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			for _, level := range []struct {
+				name  string
+				level components.CompressionLevel
+			}{
+				{"gzip-default", components.CompressionDefault},
+				{"gzip-speed", components.CompressionSpeed},
+				{"none", components.CompressionNone},
+			} {
+				b.Run(name+"/"+level.name, func(b *testing.B) {
+					client := newIngestClient(b, newIngestServer(b, retry).URL, level.level)
+					b.ReportAllocs()
+					for b.Loop() {
+						if err := client.IngestLogs(context.Background(), entries); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package components
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to an outgoing ingest request. It is called
+// for every attempt, including retries, so implementations may rotate
+// credentials between calls. The request body can be read through
+// req.GetBody, which allows signing the payload.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// TLSAuthenticator is an Authenticator that also takes part in the TLS
+// handshake, e.g. by presenting a client certificate.
+type TLSAuthenticator interface {
+	Authenticator
+	ConfigureTLS(cfg *tls.Config)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// StaticAPIKey sends key in the X-API-Key header.
+func StaticAPIKey(key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set(headerAPIKey, key)
+		return nil
+	})
+}
+
+// FileAPIKey sends the content of the file at path in the X-API-Key header.
+// The file is re-read whenever its modification time or size changes, which
+// picks up rotated Kubernetes secrets.
+func FileAPIKey(path string) Authenticator {
+	src := &fileSource{path: path}
+	return AuthenticatorFunc(func(req *http.Request) error {
+		key, err := src.load()
+		if err != nil {
+			return err
+		}
+		req.Header.Set(headerAPIKey, string(key))
+		return nil
+	})
+}
+
+// BearerToken sends token in the Authorization header.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// FileBearerToken sends the content of the file at path as a bearer token,
+// re-reading it on change like FileAPIKey.
+func FileBearerToken(path string) Authenticator {
+	src := &fileSource{path: path}
+	return AuthenticatorFunc(func(req *http.Request) error {
+		token, err := src.load()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+string(token))
+		return nil
+	})
+}
+
+// ChainAuth applies all authenticators in order, e.g. a client certificate
+// together with an API key.
+func ChainAuth(auths ...Authenticator) Authenticator {
+	return chainAuth(auths)
+}
+
+type chainAuth []Authenticator
+
+func (c chainAuth) Authenticate(req *http.Request) error {
+	for _, auth := range c {
+		if err := auth.Authenticate(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c chainAuth) ConfigureTLS(cfg *tls.Config) {
+	for _, auth := range c {
+		if tlsAuth, ok := auth.(TLSAuthenticator); ok {
+			tlsAuth.ConfigureTLS(cfg)
+		}
+	}
+}
+
+// MTLSAuth presents a client certificate loaded from PEM files. The pair is
+// reloaded on the next handshake after either file changes, so rotated
+// certificates are used by new connections without restarting.
+type MTLSAuth struct {
+	cert *fileSource
+	key  *fileSource
+
+	mu   sync.Mutex
+	pair *tls.Certificate
+}
+
+// NewMTLSAuth loads the certificate and key pair at certFile and keyFile.
+func NewMTLSAuth(certFile, keyFile string) (*MTLSAuth, error) {
+	if certFile == "" {
+		return nil, errors.New("field certFile is required")
+	}
+	if keyFile == "" {
+		return nil, errors.New("field keyFile is required")
+	}
+	a := &MTLSAuth{
+		cert: &fileSource{path: certFile, raw: true},
+		key:  &fileSource{path: keyFile, raw: true},
+	}
+	if _, err := a.certificate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate does nothing, the client is authenticated during the TLS
+// handshake.
+func (a *MTLSAuth) Authenticate(*http.Request) error {
+	return nil
+}
+
+func (a *MTLSAuth) ConfigureTLS(cfg *tls.Config) {
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return a.certificate()
+	}
+}
+
+// certificate returns the current pair. A pair failing to load, e.g. while
+// only one of the files has been rotated, keeps the previous one in use.
+func (a *MTLSAuth) certificate() (*tls.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	certPEM, certChanged, err := a.cert.loadChanged()
+	if err != nil {
+		return a.fallback(err)
+	}
+	keyPEM, keyChanged, err := a.key.loadChanged()
+	if err != nil {
+		return a.fallback(err)
+	}
+	if a.pair != nil && !certChanged && !keyChanged {
+		return a.pair, nil
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return a.fallback(fmt.Errorf("loading client certificate: %w", err))
+	}
+	a.pair = &pair
+	return a.pair, nil
+}
+
+func (a *MTLSAuth) fallback(err error) (*tls.Certificate, error) {
+	if a.pair != nil {
+		return a.pair, nil
+	}
+	return nil, err
+}
+
+// fileSource caches a file's content and re-reads it when the modification
+// time or size reported by stat changes.
+type fileSource struct {
+	path string
+	raw  bool // Keep surrounding whitespace, otherwise it is trimmed.
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   []byte
+}
+
+func (s *fileSource) load() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, _, err := s.reload()
+	if err != nil && s.value != nil {
+		// Keep the last good value while a rotation is in progress.
+		return s.value, nil
+	}
+	return value, err
+}
+
+func (s *fileSource) loadChanged() ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reload()
+}
+
+func (s *fileSource) reload() ([]byte, bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading credentials: %w", err)
+	}
+	if s.value != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value, false, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading credentials: %w", err)
+	}
+	if !s.raw {
+		data = bytes.TrimSpace(data)
+	}
+	if len(data) == 0 {
+		return nil, false, fmt.Errorf("reading credentials: file %s is empty", s.path)
+	}
+	s.value, s.modTime, s.size = data, info.ModTime(), info.Size()
+	return s.value, true, nil
+}
@@ -0,0 +1,195 @@
+package components
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	entries := []Entry{{Level: "info", Message: "msg", Time: time.Now()}}
+	newClient := func(t *testing.T, url string, auth Authenticator) *APIClientImpl {
+		client, err := NewAPIClient(Config{
+			APIBaseURL: url,
+			ClusterID:  "cluster-123",
+			Component:  "test-component",
+			Version:    "v1.0.0",
+			MaxRetries: -1,
+			Auth:       auth,
+		})
+		require.NoError(t, err)
+		return client
+	}
+	headerServer := func(t *testing.T) (*httptest.Server, *[]http.Header) {
+		var headers []http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = append(headers, r.Header.Clone())
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server, &headers
+	}
+
+	t.Run("should send static API key and bearer token", func(t *testing.T) {
+		r := require.New(t)
+		server, headers := headerServer(t)
+
+		r.NoError(newClient(t, server.URL, StaticAPIKey("static-key")).IngestLogs(context.Background(), entries))
+		r.NoError(newClient(t, server.URL, BearerToken("token")).IngestLogs(context.Background(), entries))
+
+		r.Equal("static-key", (*headers)[0].Get(headerAPIKey))
+		r.Equal("Bearer token", (*headers)[1].Get("Authorization"))
+		r.Empty((*headers)[1].Get(headerAPIKey))
+	})
+
+	t.Run("should default to APIKey", func(t *testing.T) {
+		server, headers := headerServer(t)
+		client, err := NewAPIClient(Config{
+			APIBaseURL: server.URL,
+			APIKey:     "test-api-key",
+			ClusterID:  "cluster-123",
+			Component:  "test-component",
+			Version:    "v1.0.0",
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+		require.Equal(t, "test-api-key", (*headers)[0].Get(headerAPIKey))
+	})
+
+	t.Run("should re-read rotated credential files", func(t *testing.T) {
+		r := require.New(t)
+		server, headers := headerServer(t)
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "api-key")
+		tokenFile := filepath.Join(dir, "token")
+		r.NoError(os.WriteFile(keyFile, []byte("key-1\n"), 0o600))
+		r.NoError(os.WriteFile(tokenFile, []byte("token-1"), 0o600))
+
+		client := newClient(t, server.URL, ChainAuth(FileAPIKey(keyFile), FileBearerToken(tokenFile)))
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.NoError(os.WriteFile(keyFile, []byte("key-two\n"), 0o600))
+		r.NoError(os.WriteFile(tokenFile, []byte("token-two"), 0o600))
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		// A file missing mid-rotation keeps the last value.
+		r.NoError(os.Remove(keyFile))
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Len(*headers, 3)
+		r.Equal("key-1", (*headers)[0].Get(headerAPIKey))
+		r.Equal("Bearer token-1", (*headers)[0].Get("Authorization"))
+		r.Equal("key-two", (*headers)[1].Get(headerAPIKey))
+		r.Equal("Bearer token-two", (*headers)[1].Get("Authorization"))
+		r.Equal("key-two", (*headers)[2].Get(headerAPIKey))
+	})
+
+	t.Run("should fail without sending when credentials are missing", func(t *testing.T) {
+		server, headers := headerServer(t)
+		client := newClient(t, server.URL, FileAPIKey(filepath.Join(t.TempDir(), "missing")))
+		err := client.IngestLogs(context.Background(), entries)
+		require.ErrorIs(t, err, os.ErrNotExist)
+		require.Empty(t, *headers)
+	})
+
+	t.Run("should support custom authenticators", func(t *testing.T) {
+		server, headers := headerServer(t)
+		client := newClient(t, server.URL, AuthenticatorFunc(func(req *http.Request) error {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+			req.Header.Set("X-Signature", "signed")
+			return nil
+		}))
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+		require.Equal(t, "signed", (*headers)[0].Get("X-Signature"))
+
+		client = newClient(t, server.URL, AuthenticatorFunc(func(*http.Request) error {
+			return errors.New("signer unavailable")
+		}))
+		require.ErrorContains(t, client.IngestLogs(context.Background(), entries), "signer unavailable")
+	})
+
+	t.Run("should present reloaded client certificates", func(t *testing.T) {
+		r := require.New(t)
+		var peers []string
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peers = append(peers, r.TLS.PeerCertificates[0].Subject.CommonName)
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		server.StartTLS()
+		defer server.Close()
+
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "tls.crt")
+		keyFile := filepath.Join(dir, "tls.key")
+		writeClientCert(t, certFile, keyFile, "client-1")
+
+		auth, err := NewMTLSAuth(certFile, keyFile)
+		r.NoError(err)
+		client, err := NewAPIClient(Config{
+			APIBaseURL: server.URL,
+			ClusterID:  "cluster-123",
+			Component:  "test-component",
+			Version:    "v1.0.0",
+			TLSCert: string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.Certificate().Raw,
+			})),
+			Auth: ChainAuth(auth, StaticAPIKey("key")),
+		})
+		r.NoError(err)
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		writeClientCert(t, certFile, keyFile, "client-rotated")
+		client.httpClient.CloseIdleConnections()
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Equal([]string{"client-1", "client-rotated"}, peers)
+	})
+
+	t.Run("should require readable certificate files", func(t *testing.T) {
+		_, err := NewMTLSAuth(filepath.Join(t.TempDir(), "missing.crt"), "missing.key")
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = NewMTLSAuth("", "tls.key")
+		require.EqualError(t, err, "field certFile is required")
+	})
+}
+
+func writeClientCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
@@ -2,11 +2,35 @@ package components
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrClientClosed is returned when entries are ingested into or flushed
+	// from a closed BatchClient.
+	ErrClientClosed = errors.New("batch client is closed")
+	// ErrClientNotStarted is returned when a BatchClient that was never
+	// started is flushed, or had no room for an entry within EnqueueTimeout.
+	ErrClientNotStarted = errors.New("batch client is not started, call Start or Run")
+	// ErrEntriesDropped is reported through OnError when the overflow policy
+	// dropped entries, or when a batch failed for good with neither a spool
+	// nor OnDeadLetter to take it.
+	ErrEntriesDropped = errors.New("log entries dropped")
+	// ErrRetryQueueFull is passed to OnDeadLetter with a failed batch that
+	// could not be retried because the queue is full.
+	ErrRetryQueueFull = errors.New("queue is full, batch not retried")
+)
+
 func EnqueueTimeout(timeout time.Duration) func(*BatchClientConfig) {
 	return func(config *BatchClientConfig) {
 		config.EnqueueTimeout = timeout
@@ -25,108 +49,907 @@ func BatchSize(size int) func(*BatchClientConfig) {
 	}
 }
 
+// MaxBatchBytes caps the estimated encoded size of a batch. A single entry
+// larger than that is sent in a batch of its own.
+func MaxBatchBytes(n int) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MaxBatchBytes = n
+	}
+}
+
+// MaxQueuedBytes bounds the memory held by entries waiting to be sent,
+// including failed batches waiting to be retried.
+func MaxQueuedBytes(n int) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MaxQueuedBytes = n
+	}
+}
+
+// MaxQueuedEntries bounds the number of entries waiting to be sent,
+// including failed batches waiting to be retried. It defaults to BatchSize*2
+// unless MaxQueuedBytes is set, which then bounds the queue alone.
+func MaxQueuedEntries(n int) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MaxQueuedEntries = n
+	}
+}
+
+// Concurrency sets the number of batches sent at the same time. Entries
+// keep their order within a batch, batches may complete in any order.
+func Concurrency(n int) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.Concurrency = n
+	}
+}
+
+// MinFlushInterval enables adaptive flushing: while batches fill up before
+// the flush interval elapses, the interval is halved down to this value,
+// and it grows back to FlushInterval once load drops.
+func MinFlushInterval(interval time.Duration) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MinFlushInterval = interval
+	}
+}
+
+// ShutdownTimeout bounds the final flush when the client is closed or the
+// Run context is canceled.
+func ShutdownTimeout(timeout time.Duration) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.ShutdownTimeout = timeout
+	}
+}
+
+// WithSpool persists batches that failed to publish to s. Spooled batches
+// are replayed in order, before newer ones, on the next flush and when Run
+// starts, so they survive outages and restarts. Order across batches is
+// only kept with a Concurrency of 1.
+func WithSpool(s *Spool) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.Spool = s
+	}
+}
+
+// MaxBatchRetries sets how many times a failed batch is requeued before it
+// is spooled or dead-lettered (-1 = no retries). Requeued batches count
+// against the queue limits: while they fill the queue, new entries are
+// subject to the overflow policy, and a failed batch that doesn't fit
+// anymore is spooled or dead-lettered with ErrRetryQueueFull right away.
+func MaxBatchRetries(n int) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MaxBatchRetries = n
+	}
+}
+
+// MaxRetryBackoffWait caps the exponential backoff between retries of a
+// failed batch.
+func MaxRetryBackoffWait(wait time.Duration) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.MaxRetryBackoffWait = wait
+	}
+}
+
+// OnDeadLetter is called with batches that failed after all retries, with
+// the last error, when no spool is configured. Agents can count the loss,
+// spill the batch elsewhere or alert. It must not block for long.
+func OnDeadLetter(fn func(entries []Entry, err error)) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.OnDeadLetter = fn
+	}
+}
+
+// OnError is called with publishing, spooling and overflow errors. It
+// defaults to log.Printf.
+func OnError(fn func(err error)) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.OnError = fn
+	}
+}
+
+// Overflow sets what IngestLogs does when the queue is full.
+func Overflow(policy OverflowPolicy) func(*BatchClientConfig) {
+	return func(config *BatchClientConfig) {
+		config.Overflow = policy
+	}
+}
+
+// OverflowPolicy decides which entries give way when the queue is full.
+// Whatever the policy, error entries make room by dropping the oldest
+// entry of a lower level first. Entries waiting to be retried are never
+// dropped in favor of new ones.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits up to EnqueueTimeout for room and then fails.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entry being ingested.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued entry of the same lane.
+	OverflowDropOldest
+)
+
 type BatchClientConfig struct {
-	EnqueueTimeout time.Duration
-	FlushInterval  time.Duration
-	BatchSize      int
+	EnqueueTimeout   time.Duration
+	FlushInterval    time.Duration
+	MinFlushInterval time.Duration // Defaults to FlushInterval, which disables adaptive flushing.
+	BatchSize        int
+	MaxBatchBytes    int // Defaults to 1MiB.
+	MaxQueuedBytes   int // Defaults to 16MiB.
+	MaxQueuedEntries int // Defaults to BatchSize*2, or unlimited when MaxQueuedBytes is set.
+	Concurrency      int // Defaults to 1.
+	ShutdownTimeout  time.Duration
+	Overflow         OverflowPolicy
+	Spool            *Spool
+
+	MaxBatchRetries     int // Defaults to 3.
+	MaxRetryBackoffWait time.Duration
+	OnDeadLetter        func(entries []Entry, err error)
+	OnError             func(err error)
+}
+
+type BatchClientStats struct {
+	QueuedEntries int
+	QueuedBytes   int
+	Dropped       map[string]uint64 // By Entry.Level.
 }
 
 var _ APIClient = (*BatchClient)(nil)
 
+// BatchClient queues entries and publishes them in batches from a
+// background loop started with Start or Run. Batches are cut by entry count
+// and estimated encoded size, and sent by Concurrency senders. Close stops
+// it, publishing what is still queued.
 type BatchClient struct {
-	buffer chan Entry
 	client APIClient
 	cfg    BatchClientConfig
+
+	// qmu guards the queue.
+	qmu         sync.Mutex
+	priority    []Entry // Error entries, sent first.
+	queue       []Entry
+	queuedBytes int
+	urgent      bool // An error was queued, flush right away.
+	retries     []retryBatch
+	retryCount  int // Entries in retries.
+	retryBytes  int // Estimated size of the entries in retries.
+	dropped     map[string]uint64
+	reported    map[string]uint64 // Drops already reported.
+	space       chan struct{}     // Closed and replaced when entries are dequeued.
+	ready       chan struct{}     // Signals the loop that a full batch is queued.
+
+	// lifecycle serializes starting and closing.
+	lifecycle sync.Mutex
+	started   atomic.Bool
+	// mu guards closed. IngestLogs holds the read lock while enqueuing and
+	// closed is set before the loop is told to drain, so no entry is
+	// enqueued after the final drain started.
+	mu         sync.RWMutex
+	closed     bool
+	wake       chan struct{} // Closed before closed is set, wakes blocked IngestLogs calls.
+	rejectOnce sync.Once
+
+	jobs     chan *batchJob
+	replayMu sync.Mutex  // Serializes spool replays of concurrent senders.
+	stopping atomic.Bool // Set on shutdown, failed batches are not retried anymore.
+
+	flushReq chan flushRequest
+	closing  chan struct{} // Closed by Close.
+	done     chan struct{} // Closed when the loop exits.
+	closeErr error         // Result of the final flush, set before done is closed.
+}
+
+type flushRequest struct {
+	ctx    context.Context
+	result chan error
+}
+
+// batch is a batch of entries with the number of times it was sent. Its ID
+// is kept by requeues and the spool so the server can deduplicate resends.
+type batch struct {
+	id      string
+	entries []Entry
+	attempt int
+}
+
+// retryBatch is a failed batch waiting for its backoff to pass.
+type retryBatch struct {
+	batch
+	due  time.Time
+	size int // Estimated size of the entries.
+}
+
+// batchJob is a batch handed to a sender. done is closed once err is set.
+type batchJob struct {
+	batch
+	ctx  context.Context
+	err  error
+	done chan struct{}
 }
 
 func NewBatchClient(client APIClient, opts ...func(*BatchClientConfig)) *BatchClient {
 	cfg := BatchClientConfig{
-		EnqueueTimeout: 5 * time.Second,
-		FlushInterval:  5 * time.Second,
-		BatchSize:      100,
+		EnqueueTimeout:  5 * time.Second,
+		FlushInterval:   5 * time.Second,
+		BatchSize:       100,
+		MaxBatchBytes:   1 << 20,
+		Concurrency:     1,
+		ShutdownTimeout: 10 * time.Second,
+
+		MaxBatchRetries:     3,
+		MaxRetryBackoffWait: 30 * time.Second,
 	}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	switch {
+	case cfg.MaxQueuedEntries > 0:
+	case cfg.MaxQueuedBytes > 0:
+		// A byte budget replaces the entry count limit.
+		cfg.MaxQueuedEntries = math.MaxInt
+	default:
+		cfg.MaxQueuedEntries = cfg.BatchSize * 2
+	}
+	if cfg.MaxQueuedBytes <= 0 {
+		cfg.MaxQueuedBytes = 16 << 20
+	}
+	if cfg.MinFlushInterval <= 0 || cfg.MinFlushInterval > cfg.FlushInterval {
+		cfg.MinFlushInterval = cfg.FlushInterval
+	}
+	cfg.Concurrency = max(cfg.Concurrency, 1)
 
 	b := &BatchClient{
-		buffer: make(chan Entry, cfg.BatchSize*2),
-		client: client,
-		cfg:    cfg,
+		client:   client,
+		cfg:      cfg,
+		dropped:  make(map[string]uint64),
+		reported: make(map[string]uint64),
+		space:    make(chan struct{}),
+		ready:    make(chan struct{}, 1),
+		jobs:     make(chan *batchJob),
+		flushReq: make(chan flushRequest),
+		wake:     make(chan struct{}),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 
 	return b
 }
 
 func (b *BatchClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrClientClosed
+	}
+
 	enqTimeout := time.After(b.cfg.EnqueueTimeout)
 	for _, entry := range entries {
+		if len(entry.Message) == 0 {
+			continue
+		}
+		// Numbered on enqueue so the number is kept by requeues and the
+		// spool.
+		numberEntry(&entry)
+		size := entrySize(entry)
+		for {
+			space, ok := b.enqueue(entry, size)
+			if ok {
+				break
+			}
+			select {
+			case <-space:
+				// Entries were dequeued, try again.
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-b.wake:
+				return ErrClientClosed
+			case <-enqTimeout:
+				if !b.started.Load() {
+					// Nothing drained the queue, Start or Run wasn't called.
+					return ErrClientNotStarted
+				}
+				return errors.New("timeout: buffer is full, cannot enqueue log entry")
+			}
+		}
+	}
+
+	return nil
+}
+
+// enqueue adds entry to the queue, applying the overflow policy when the
+// queue is full. With OverflowBlock it returns a channel closed once there
+// may be room instead.
+func (b *BatchClient) enqueue(entry Entry, size int) (<-chan struct{}, bool) {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+
+	priority := isPriority(entry)
+	for b.full(size) {
+		// Errors are never dropped in favor of lower levels.
+		if priority && b.evict(false) {
+			continue
+		}
+		switch b.cfg.Overflow {
+		case OverflowBlock:
+			return b.space, false
+		case OverflowDropOldest:
+			if b.evict(priority) {
+				continue
+			}
+		case OverflowDropNewest:
+		}
+		b.dropped[entry.Level]++
+		return nil, true
+	}
+
+	if priority {
+		b.priority = append(b.priority, entry)
+		b.urgent = true
+	} else {
+		b.queue = append(b.queue, entry)
+	}
+	b.queuedBytes += size
+	if b.urgent || b.queued() >= b.cfg.BatchSize || b.queuedBytes >= b.cfg.MaxBatchBytes {
 		select {
-		case b.buffer <- entry:
-			// Successfully enqueued.
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-enqTimeout:
-			return errors.New("timeout: buffer is full, cannot enqueue log entry")
+		case b.ready <- struct{}{}:
+		default:
 		}
 	}
+	return nil, true
+}
+
+// full reports whether an entry of size doesn't fit the queue limits. An
+// entry larger than the whole queue is let in when the queue is empty, so it
+// isn't stuck forever.
+func (b *BatchClient) full(size int) bool {
+	return !b.fits(1, size)
+}
+
+// fits reports whether n entries of size bytes fit the queue limits, which
+// also hold the entries waiting to be retried.
+func (b *BatchClient) fits(n, size int) bool {
+	queued := b.queued() + b.retryCount
+	return queued+n <= b.cfg.MaxQueuedEntries &&
+		(queued == 0 || b.queuedBytes+b.retryBytes+size <= b.cfg.MaxQueuedBytes)
+}
+
+func (b *BatchClient) queued() int {
+	return len(b.priority) + len(b.queue)
+}
+
+// evict drops the oldest queued entry of the priority or the regular lane,
+// reporting whether there was one.
+func (b *BatchClient) evict(priority bool) bool {
+	lane := &b.queue
+	i := -1
+	if priority && len(b.priority) > 0 {
+		lane, i = &b.priority, 0
+	} else {
+		// Entries put back by requeue may be of either lane.
+		i = slices.IndexFunc(b.queue, func(e Entry) bool { return isPriority(e) == priority })
+	}
+	if i < 0 {
+		return false
+	}
+	e := (*lane)[i]
+	*lane = slices.Delete(*lane, i, i+1)
+	b.queuedBytes -= entrySize(e)
+	b.dropped[e.Level]++
+	return true
+}
+
+func isPriority(e Entry) bool {
+	return e.Level == string(LogLevelError)
+}
+
+// SchemaVersion returns the schema version of the wrapped client,
+// SchemaVersionV1 if it doesn't report one.
+func (b *BatchClient) SchemaVersion() string {
+	if v, ok := b.client.(SchemaVersioner); ok {
+		return v.SchemaVersion()
+	}
+	return SchemaVersionV1
+}
+
+// Stats returns the queue state and the number of entries dropped so far,
+// by level: by the overflow policy, or with batches that failed for good and
+// were neither spooled nor dead-lettered.
+func (b *BatchClient) Stats() BatchClientStats {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+	return BatchClientStats{
+		QueuedEntries: b.queued() + b.retryCount,
+		QueuedBytes:   b.queuedBytes + b.retryBytes,
+		Dropped:       maps.Clone(b.dropped),
+	}
+}
 
+// dequeue cuts batches from the queue, priority entries first. With all set,
+// or when an error was queued, it takes every queued entry, otherwise only
+// full batches.
+func (b *BatchClient) dequeue(all bool) [][]Entry {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+
+	if len(b.priority) > 0 {
+		b.queue = slices.Concat(b.priority, b.queue)
+		b.priority = nil
+	}
+	all = all || b.urgent
+	b.urgent = false
+
+	var batches [][]Entry
+	for len(b.queue) > 0 {
+		n, size := 0, 0
+		for n < len(b.queue) && n < b.cfg.BatchSize {
+			entrySize := entrySize(b.queue[n])
+			if n > 0 && size+entrySize > b.cfg.MaxBatchBytes {
+				break
+			}
+			size += entrySize
+			n++
+		}
+		full := n == b.cfg.BatchSize || n < len(b.queue) || size >= b.cfg.MaxBatchBytes
+		if !full && !all {
+			break
+		}
+		batches = append(batches, slices.Clone(b.queue[:n]))
+		b.queue = b.queue[n:]
+		b.queuedBytes -= size
+	}
+	if len(b.queue) == 0 {
+		b.queue = nil
+		b.queuedBytes = 0
+	}
+	if len(batches) > 0 {
+		close(b.space)
+		b.space = make(chan struct{})
+	}
+	return batches
+}
+
+// Start runs the batching loop in the background until ctx is canceled or
+// Close is called, like Run.
+func (b *BatchClient) Start(ctx context.Context) error {
+	if err := b.markStarted(); err != nil {
+		return err
+	}
+	go func() {
+		_ = b.run(ctx)
+	}()
 	return nil
 }
 
+// Run runs the batching loop until ctx is canceled or Close is called.
+// Either way, the client rejects new entries with ErrClientClosed and
+// publishes the queued ones before Run returns.
 func (b *BatchClient) Run(ctx context.Context) error {
+	if err := b.markStarted(); err != nil {
+		return err
+	}
 	return b.run(ctx)
 }
 
+// Flush publishes everything enqueued so far and waits for the result.
+func (b *BatchClient) Flush(ctx context.Context) error {
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return ErrClientClosed
+	}
+	if !b.started.Load() {
+		return ErrClientNotStarted
+	}
+
+	req := flushRequest{ctx: ctx, result: make(chan error, 1)}
+	select {
+	case b.flushReq <- req:
+	case <-b.done:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close rejects new entries, publishes the queued ones and returns the
+// result of that final flush. It waits at most until ctx is done, returning
+// ctx.Err() then; the final flush itself is bounded by the shutdown timeout.
+func (b *BatchClient) Close(ctx context.Context) error {
+	b.lifecycle.Lock()
+	select {
+	case <-b.closing:
+		b.lifecycle.Unlock()
+		return ErrClientClosed
+	default:
+	}
+	// The loop drains only once no more entries come in.
+	b.reject()
+	close(b.closing)
+	started := b.started.Load()
+	b.lifecycle.Unlock()
+
+	if !started {
+		go func() {
+			b.closeErr = b.shutdown(nil)
+			close(b.done)
+		}()
+	}
+
+	select {
+	case <-b.done:
+		return b.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reject makes IngestLogs fail with ErrClientClosed. IngestLogs calls
+// waiting for room are woken first, they hold the read lock until they
+// return.
+func (b *BatchClient) reject() {
+	b.rejectOnce.Do(func() {
+		close(b.wake)
+	})
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+}
+
+func (b *BatchClient) markStarted() error {
+	b.lifecycle.Lock()
+	defer b.lifecycle.Unlock()
+	select {
+	case <-b.closing:
+		return ErrClientClosed
+	default:
+	}
+	if !b.started.CompareAndSwap(false, true) {
+		return errors.New("batch client is already started")
+	}
+	return nil
+}
+
 func (b *BatchClient) run(ctx context.Context) error {
-	ticker := time.NewTicker(b.cfg.FlushInterval)
-	defer ticker.Stop()
+	defer close(b.done)
+
+	var senders sync.WaitGroup
+	for range b.cfg.Concurrency {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			b.send()
+		}()
+	}
+	defer func() {
+		close(b.jobs)
+		senders.Wait()
+	}()
+
+	// Replay batches spooled before a restart.
+	_ = b.flush(ctx, batch{})
 
-	entries := make([]Entry, 0, b.cfg.BatchSize)
+	interval := b.cfg.FlushInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	var inflight []*batchJob
 	for {
 		select {
-		case entry := <-b.buffer:
-			if len(entry.Message) == 0 {
+		case <-b.ready:
+			inflight = b.dispatch(ctx, inflight, b.dueRetries(false))
+			full := b.dequeue(false)
+			if len(full) == 0 {
 				continue
 			}
-			entries = append(entries, entry)
-			if len(entries) >= b.cfg.BatchSize {
-				b.flush(ctx, entries)
-				entries = entries[:0]
+			inflight = b.dispatch(ctx, inflight, newBatches(full))
+			// Batches fill up before the interval elapses, flush sooner.
+			for range full {
+				interval = max(interval/2, b.cfg.MinFlushInterval)
+			}
+			timer.Reset(interval)
+		case <-timer.C:
+			b.reportDrops()
+			batches := append(b.dueRetries(false), newBatches(b.dequeue(true))...)
+			if len(batches) == 0 && b.cfg.Spool != nil && !b.cfg.Spool.Empty() {
+				// Nothing new to send, retry the spooled batches.
+				batches = []batch{{}}
 			}
-		case <-ticker.C:
-			b.flush(ctx, entries)
-			entries = entries[:0]
+			inflight = b.dispatch(ctx, inflight, batches)
+			interval = min(interval*2, b.cfg.FlushInterval)
+			timer.Reset(interval)
+		case req := <-b.flushReq:
+			batches := append(b.dueRetries(true), newBatches(b.dequeue(true))...)
+			inflight = b.dispatch(req.ctx, inflight, batches)
+			pending := slices.Clone(inflight)
+			go func() {
+				req.result <- waitJobs(req.ctx, pending)
+			}()
+		case <-b.closing:
+			b.closeErr = b.shutdown(inflight)
+			return b.closeErr
 		case <-ctx.Done():
-			b.drainBuffer(&entries)
-			// Use a new context with timeout for graceful shutdown.
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			b.flush(shutdownCtx, entries)
+			b.reject()
+			b.closeErr = b.shutdown(inflight)
 			return ctx.Err()
 		}
 	}
 }
 
-func (b *BatchClient) drainBuffer(entries *[]Entry) {
-	for {
+// reportDrops reports the entries dropped since the last report.
+func (b *BatchClient) reportDrops() {
+	b.qmu.Lock()
+	unreported := make(map[string]uint64)
+	for level, n := range b.dropped {
+		if n > b.reported[level] {
+			unreported[level] = n - b.reported[level]
+			b.reported[level] = n
+		}
+	}
+	b.qmu.Unlock()
+	if len(unreported) > 0 {
+		b.reportError(fmt.Errorf("%w, queue is full: %s", ErrEntriesDropped, formatDrops(unreported)))
+	}
+}
+
+// formatDrops formats dropped entry counts as sorted level=count pairs.
+func formatDrops(dropped map[string]uint64) string {
+	report := make([]string, 0, len(dropped))
+	for level, n := range dropped {
+		report = append(report, fmt.Sprintf("%s=%d", level, n))
+	}
+	slices.Sort(report)
+	return strings.Join(report, " ")
+}
+
+func (b *BatchClient) reportError(err error) {
+	if b.cfg.OnError != nil {
+		b.cfg.OnError(err)
+		return
+	}
+	log.Printf("%v", err)
+}
+
+// dispatch hands batches to the senders and returns the jobs still in
+// flight.
+func (b *BatchClient) dispatch(ctx context.Context, inflight []*batchJob, batches []batch) []*batchJob {
+	inflight = slices.DeleteFunc(inflight, func(job *batchJob) bool {
 		select {
-		case entry := <-b.buffer:
-			if len(entry.Message) > 0 {
-				*entries = append(*entries, entry)
-			}
+		case <-job.done:
+			return true
 		default:
-			// Buffer is empty.
+			return false
+		}
+	})
+	for _, batch := range batches {
+		job := &batchJob{batch: batch, ctx: ctx, done: make(chan struct{})}
+		select {
+		case b.jobs <- job:
+			inflight = append(inflight, job)
+		case <-ctx.Done():
+			// Publish it with the rest on shutdown or the next flush.
+			b.requeue(batch, time.Now(), true)
+		case <-b.closing:
+			b.requeue(batch, time.Now(), true)
+		}
+	}
+	return inflight
+}
+
+func (b *BatchClient) send() {
+	for job := range b.jobs {
+		job.err = b.flush(job.ctx, job.batch)
+		close(job.done)
+	}
+}
+
+// requeue puts a batch in the retry lane, to be sent again once due. Unless
+// force is set, a batch that doesn't fit the queue limits is refused.
+func (b *BatchClient) requeue(batch batch, due time.Time, force bool) bool {
+	if len(batch.entries) == 0 {
+		return true
+	}
+	size := 0
+	for _, e := range batch.entries {
+		size += entrySize(e)
+	}
+	b.qmu.Lock()
+	if !force && !b.fits(len(batch.entries), size) {
+		b.qmu.Unlock()
+		return false
+	}
+	b.retries = append(b.retries, retryBatch{batch: batch, due: due, size: size})
+	b.retryCount += len(batch.entries)
+	b.retryBytes += size
+	b.qmu.Unlock()
+	time.AfterFunc(time.Until(due), b.signalReady)
+	return true
+}
+
+// dueRetries takes the retry batches whose backoff passed, or all of them.
+func (b *BatchClient) dueRetries(all bool) []batch {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+	now := time.Now()
+	var due []batch
+	b.retries = slices.DeleteFunc(b.retries, func(r retryBatch) bool {
+		if all || !r.due.After(now) {
+			due = append(due, r.batch)
+			b.retryCount -= len(r.entries)
+			b.retryBytes -= r.size
+			return true
+		}
+		return false
+	})
+	if len(due) > 0 {
+		close(b.space)
+		b.space = make(chan struct{})
+	}
+	return due
+}
+
+func (b *BatchClient) signalReady() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+func newBatches(entries [][]Entry) []batch {
+	batches := make([]batch, len(entries))
+	for i, e := range entries {
+		batches[i] = batch{id: NewBatchID(), entries: e}
+	}
+	return batches
+}
+
+// waitJobs waits for jobs to complete and returns their joined errors.
+func waitJobs(ctx context.Context, jobs []*batchJob) error {
+	var errs []error
+	for _, job := range jobs {
+		select {
+		case <-job.done:
+			errs = append(errs, job.err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shutdown publishes the queued entries within the shutdown timeout and
+// waits for the batches in flight. Batches failing now are not retried.
+func (b *BatchClient) shutdown(inflight []*batchJob) error {
+	b.stopping.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), b.cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, batch := range append(b.dueRetries(true), newBatches(b.dequeue(true))...) {
+		errs = append(errs, b.flush(shutdownCtx, batch))
+	}
+	errs = append(errs, waitJobs(shutdownCtx, inflight))
+	return errors.Join(errs...)
+}
+
+// flush publishes a batch and returns the publishing error. Failed batches
+// are requeued with backoff until retries are exhausted, then spooled when a
+// spool is configured, passed to OnDeadLetter or else dropped.
+func (b *BatchClient) flush(ctx context.Context, batch batch) error {
+	if b.cfg.Spool != nil {
+		if err := b.replay(ctx); err != nil {
+			// Newer batches wait behind the spooled ones to keep them in order.
+			b.spool(batch)
+			return err
+		}
+	}
+	if len(batch.entries) == 0 {
+		return nil
+	}
+	err := b.client.IngestLogs(WithBatchID(ctx, batch.id), batch.entries)
+	if err != nil {
+		b.reportError(fmt.Errorf("failed to publish logs: %w", err))
+		b.failed(batch, err)
+	}
+	return err
+}
+
+func (b *BatchClient) failed(failed batch, err error) {
+	if failed.attempt < b.cfg.MaxBatchRetries && !b.stopping.Load() {
+		failed.attempt++
+		if b.requeue(failed, time.Now().Add(backoffDelay(failed.attempt, b.cfg.MaxRetryBackoffWait)), false) {
 			return
 		}
+		err = fmt.Errorf("%w: %w", ErrRetryQueueFull, err)
+	}
+	switch {
+	case b.cfg.Spool != nil:
+		b.spool(failed)
+	case b.cfg.OnDeadLetter != nil:
+		b.cfg.OnDeadLetter(failed.entries, err)
+	default:
+		dropped := make(map[string]uint64)
+		b.qmu.Lock()
+		for _, e := range failed.entries {
+			dropped[e.Level]++
+			// Counted in Stats and reported here rather than with the overflow drops.
+			b.dropped[e.Level]++
+			b.reported[e.Level]++
+		}
+		b.qmu.Unlock()
+		b.reportError(fmt.Errorf("%w, batch failed: %s: %w", ErrEntriesDropped, formatDrops(dropped), err))
 	}
 }
 
-func (b *BatchClient) flush(ctx context.Context, e []Entry) {
-	if len(e) == 0 {
-		return
+// replay publishes spooled batches, returning an error if the spool could
+// not be drained.
+func (b *BatchClient) replay(ctx context.Context) error {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+	if b.cfg.Spool.Empty() {
+		return nil
 	}
-	if err := b.client.IngestLogs(ctx, e); err != nil {
-		log.Printf("failed to publish logs: %v", err)
+	err := b.cfg.Spool.ReplayBatches(func(batchID string, entries []Entry) error {
+		if batchID == "" {
+			batchID = NewBatchID()
+		}
+		return b.client.IngestLogs(WithBatchID(ctx, batchID), entries)
+	})
+	if err != nil {
+		b.reportError(fmt.Errorf("failed to replay spooled logs: %w", err))
+	}
+	return err
+}
+
+func (b *BatchClient) spool(batch batch) {
+	if err := b.cfg.Spool.AppendBatch(batch.id, batch.entries); err != nil {
+		b.reportError(fmt.Errorf("failed to spool logs: %w", err))
+	}
+}
+
+// entrySize estimates the JSON encoded size of an entry without encoding it.
+func entrySize(e Entry) int {
+	const entryOverhead = 96 // Keys, punctuation and the timestamp.
+	size := entryOverhead + len(e.Level) + len(e.Message) + len(e.Logger) + len(e.TraceID) + len(e.SpanID) + len(e.ProcessID)
+	for k, v := range e.Fields {
+		size += len(k) + len(v) + 6
+	}
+	if e.Attributes != nil {
+		size += valueSize(e.Attributes)
+	}
+	if e.Source != nil {
+		size += len(e.Source.File) + len(e.Source.Function) + 48
+	}
+	return size
+}
+
+func valueSize(v any) int {
+	switch v := v.(type) {
+	case string:
+		return len(v) + 2
+	case map[string]any:
+		size := 2
+		for k, item := range v {
+			size += len(k) + 4 + valueSize(item)
+		}
+		return size
+	case []any:
+		size := 2
+		for _, item := range v {
+			size += valueSize(item) + 1
+		}
+		return size
+	case json.RawMessage:
+		return len(v)
+	case bool:
+		return 5
+	case time.Time:
+		return 37
+	default:
+		return 24
 	}
 }
@@ -2,8 +2,11 @@ package components_test
 
 import (
 	"context"
+	"errors"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -194,6 +197,692 @@ func Test_BufferedClient_PublishLogs(t *testing.T) {
 	})
 }
 
+func Test_BatchClient_Lifecycle(t *testing.T) {
+	t.Run("should flush synchronously and close with the final result", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient, components.FlushInterval(time.Hour))
+		r.NoError(client.Start(context.Background()))
+		r.Error(client.Start(context.Background()), "client can be started only once")
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}, {Message: "m2"}}))
+		r.NoError(client.Flush(context.Background()))
+		r.Equal([]string{"m1", "m2"}, messages(mockAPIClient.getLogs()))
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m3"}}))
+		r.NoError(client.Close(context.Background()))
+		r.Equal([]string{"m1", "m2", "m3"}, messages(mockAPIClient.getLogs()))
+
+		r.ErrorIs(client.IngestLogs(context.Background(), []components.Entry{{Message: "m4"}}), components.ErrClientClosed)
+		r.ErrorIs(client.Flush(context.Background()), components.ErrClientClosed)
+		r.ErrorIs(client.Close(context.Background()), components.ErrClientClosed)
+	})
+
+	t.Run("should return the final flush error from Close", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &flakyAPIClient{}
+		mockAPIClient.failing.Store(true)
+		client := components.NewBatchClient(mockAPIClient, components.FlushInterval(time.Hour))
+		r.NoError(client.Start(context.Background()))
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+		r.EqualError(client.Close(context.Background()), "unavailable")
+	})
+
+	t.Run("should bound the final flush by the shutdown timeout", func(t *testing.T) {
+		r := require.New(t)
+		client := components.NewBatchClient(blockingAPIClient{},
+			components.FlushInterval(time.Hour),
+			components.ShutdownTimeout(10*time.Millisecond),
+		)
+		r.NoError(client.Start(context.Background()))
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+
+		start := time.Now()
+		r.ErrorIs(client.Close(context.Background()), context.DeadlineExceeded)
+		r.Less(time.Since(start), time.Second)
+	})
+
+	t.Run("should send every accepted entry when closed while ingesting", func(t *testing.T) {
+		for range 20 {
+			r := require.New(t)
+			mockAPIClient := &apiClient{}
+			client := components.NewBatchClient(mockAPIClient,
+				components.BatchSize(10),
+				components.FlushInterval(time.Hour),
+			)
+			r.NoError(client.Start(context.Background()))
+
+			var accepted atomic.Int64
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Go(func() {
+					for client.IngestLogs(context.Background(), []components.Entry{{Message: "m"}}) == nil {
+						accepted.Add(1)
+					}
+				})
+			}
+			time.Sleep(time.Millisecond)
+			r.NoError(client.Close(context.Background()))
+			wg.Wait()
+
+			r.EqualValues(accepted.Load(), len(mockAPIClient.getLogs()))
+		}
+	})
+
+	t.Run("should wake blocked ingesters and honor the context on close", func(t *testing.T) {
+		r := require.New(t)
+		client := components.NewBatchClient(blockingAPIClient{},
+			components.BatchSize(1),
+			components.FlushInterval(time.Hour),
+			components.EnqueueTimeout(3*time.Second),
+		)
+		r.NoError(client.Start(context.Background()))
+
+		ingested := make(chan error, 1)
+		go func() {
+			entries := make([]components.Entry, 10)
+			for i := range entries {
+				entries[i] = components.Entry{Message: "m"}
+			}
+			ingested <- client.IngestLogs(context.Background(), entries)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		r.ErrorIs(client.Close(ctx), context.DeadlineExceeded)
+		r.Less(time.Since(start), time.Second)
+		select {
+		case err := <-ingested:
+			r.ErrorIs(err, components.ErrClientClosed)
+		case <-time.After(time.Second):
+			r.Fail("IngestLogs still blocked after Close")
+		}
+	})
+
+	t.Run("should take entries ingested before Run starts the loop", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient,
+			components.BatchSize(1),
+			components.FlushInterval(time.Hour),
+		)
+		ingested := make(chan error, 1)
+		go func() {
+			ingested <- client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}, {Message: "m2"}, {Message: "m3"}})
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() {
+			errc <- client.Run(ctx)
+		}()
+		r.NoError(<-ingested)
+
+		cancel()
+		r.ErrorIs(<-errc, context.Canceled)
+		r.Equal([]string{"m1", "m2", "m3"}, messages(mockAPIClient.getLogs()))
+		r.ErrorIs(client.IngestLogs(context.Background(), []components.Entry{{Message: "m4"}}), components.ErrClientClosed,
+			"the loop stopped with its context")
+		r.ErrorIs(client.Flush(context.Background()), components.ErrClientClosed)
+	})
+
+	t.Run("should report a full buffer of a client that was never started", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient,
+			components.BatchSize(1),
+			components.EnqueueTimeout(10*time.Millisecond),
+		)
+
+		err := client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}, {Message: "m2"}, {Message: "m3"}})
+		r.ErrorIs(err, components.ErrClientNotStarted)
+		r.ErrorIs(client.Flush(context.Background()), components.ErrClientNotStarted)
+
+		r.NoError(client.Close(context.Background()))
+		r.Equal([]string{"m1", "m2"}, messages(mockAPIClient.getLogs()), "buffered entries are published on close")
+	})
+}
+
+func Test_BatchClient_SchemaVersion(t *testing.T) {
+	r := require.New(t)
+	r.Equal(components.SchemaVersionV1, components.NewBatchClient(&apiClient{}).SchemaVersion())
+
+	apiClient, err := components.NewAPIClient(components.Config{
+		APIBaseURL:    "http://localhost",
+		APIKey:        "key",
+		ClusterID:     "cluster",
+		Component:     "component",
+		Version:       "v1.0.0",
+		SchemaVersion: components.SchemaVersionV2,
+	})
+	r.NoError(err)
+	r.Equal(components.SchemaVersionV2, components.NewBatchClient(apiClient).SchemaVersion())
+}
+
+func Test_BatchClient_Limits(t *testing.T) {
+	t.Run("should cut batches by estimated bytes", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &batchRecorder{}
+		client := components.NewBatchClient(mockAPIClient, components.FlushInterval(time.Hour), components.MaxBatchBytes(400))
+		r.NoError(client.Start(context.Background()))
+
+		entries := make([]components.Entry, 6)
+		for i := range entries {
+			entries[i] = components.Entry{Message: strings.Repeat("x", 100)}
+		}
+		r.NoError(client.IngestLogs(context.Background(), entries))
+		r.NoError(client.Close(context.Background()))
+
+		sizes := mockAPIClient.batchSizes()
+		r.Equal(6, sum(sizes))
+		r.Greater(len(sizes), 1)
+		for _, size := range sizes {
+			r.LessOrEqual(size, 2)
+		}
+	})
+
+	t.Run("should bound the queue by bytes", func(t *testing.T) {
+		r := require.New(t)
+		client := components.NewBatchClient(&apiClient{},
+			components.BatchSize(100),
+			components.MaxQueuedBytes(1000),
+			components.EnqueueTimeout(10*time.Millisecond),
+		)
+
+		var err error
+		queued := 0
+		for ; queued < 100 && err == nil; queued++ {
+			err = client.IngestLogs(context.Background(), []components.Entry{{Message: strings.Repeat("x", 100)}})
+		}
+		r.ErrorIs(err, components.ErrClientNotStarted)
+		r.Less(queued, 10)
+	})
+
+	t.Run("should not bound the queue by count with a byte budget", func(t *testing.T) {
+		r := require.New(t)
+		client := components.NewBatchClient(&apiClient{},
+			components.BatchSize(1),
+			components.MaxQueuedBytes(1<<20),
+			components.EnqueueTimeout(10*time.Millisecond),
+		)
+
+		entries := make([]components.Entry, 100)
+		for i := range entries {
+			entries[i] = components.Entry{Message: "m"}
+		}
+		r.NoError(client.IngestLogs(context.Background(), entries))
+		r.Equal(100, client.Stats().QueuedEntries)
+	})
+
+	t.Run("should send batches concurrently", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &concurrencyRecorder{delay: 50 * time.Millisecond}
+		client := components.NewBatchClient(mockAPIClient,
+			components.BatchSize(1),
+			components.FlushInterval(time.Hour),
+			components.Concurrency(3),
+		)
+		r.NoError(client.Start(context.Background()))
+
+		for i := 0; i < 6; i++ {
+			r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m"}}))
+		}
+		r.NoError(client.Flush(context.Background()))
+		r.EqualValues(6, mockAPIClient.calls.Load())
+		r.Greater(mockAPIClient.maxInflight.Load(), int32(1))
+		r.LessOrEqual(mockAPIClient.maxInflight.Load(), int32(3))
+		r.NoError(client.Close(context.Background()))
+	})
+
+	t.Run("should flush sooner under load with adaptive interval", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &batchRecorder{}
+		client := components.NewBatchClient(mockAPIClient,
+			components.BatchSize(2),
+			components.FlushInterval(time.Minute),
+			components.MinFlushInterval(10*time.Millisecond),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		// Full batches shrink the interval, the trailing entry doesn't wait a minute.
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}, {Message: "m2"}}))
+		r.Eventually(func() bool { return sum(mockAPIClient.batchSizes()) == 2 }, time.Second, time.Millisecond)
+		for i := 0; i < 20; i++ {
+			r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m"}, {Message: "m"}}))
+		}
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "last"}}))
+		r.Eventually(func() bool { return sum(mockAPIClient.batchSizes()) == 43 }, 5*time.Second, time.Millisecond)
+	})
+}
+
+// batchRecorder records the size of every batch.
+type batchRecorder struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (b *batchRecorder) IngestLogs(_ context.Context, entries []components.Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sizes = append(b.sizes, len(entries))
+	return nil
+}
+
+func (b *batchRecorder) batchSizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.sizes)
+}
+
+// concurrencyRecorder tracks the max number of concurrent calls.
+type concurrencyRecorder struct {
+	delay       time.Duration
+	calls       atomic.Int32
+	inflight    atomic.Int32
+	maxInflight atomic.Int32
+}
+
+func (c *concurrencyRecorder) IngestLogs(_ context.Context, _ []components.Entry) error {
+	n := c.inflight.Add(1)
+	defer c.inflight.Add(-1)
+	for {
+		current := c.maxInflight.Load()
+		if n <= current || c.maxInflight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	c.calls.Add(1)
+	return nil
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func Test_BatchClient_Overflow(t *testing.T) {
+	ingest := func(r *require.Assertions, client *components.BatchClient, level components.LogLevel, msgs ...string) {
+		for _, msg := range msgs {
+			r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Level: string(level), Message: msg}}))
+		}
+	}
+
+	t.Run("should drop newest entries", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient, components.MaxQueuedEntries(2), components.Overflow(components.OverflowDropNewest))
+
+		ingest(r, client, components.LogLevelInfo, "m1", "m2", "m3")
+		r.NoError(client.Close(context.Background()))
+
+		r.Equal([]string{"m1", "m2"}, messages(mockAPIClient.getLogs()))
+		r.Equal(map[string]uint64{string(components.LogLevelInfo): 1}, client.Stats().Dropped)
+	})
+
+	t.Run("should drop oldest entries", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient, components.MaxQueuedEntries(2), components.Overflow(components.OverflowDropOldest))
+
+		ingest(r, client, components.LogLevelInfo, "m1", "m2", "m3")
+		r.NoError(client.Close(context.Background()))
+
+		r.Equal([]string{"m2", "m3"}, messages(mockAPIClient.getLogs()))
+	})
+
+	t.Run("should never drop errors in favor of lower levels", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient, components.MaxQueuedEntries(2), components.Overflow(components.OverflowDropNewest))
+
+		ingest(r, client, components.LogLevelDebug, "d1", "d2")
+		ingest(r, client, components.LogLevelError, "e1", "e2", "e3")
+		ingest(r, client, components.LogLevelDebug, "d3")
+		r.NoError(client.Close(context.Background()))
+
+		r.Equal([]string{"e1", "e2"}, messages(mockAPIClient.getLogs()))
+		r.Equal(map[string]uint64{
+			string(components.LogLevelDebug): 3,
+			string(components.LogLevelError): 1,
+		}, client.Stats().Dropped)
+	})
+
+	t.Run("should send errors first and flush them right away", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &apiClient{}
+		client := components.NewBatchClient(mockAPIClient, components.FlushInterval(time.Hour))
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		ingest(r, client, components.LogLevelInfo, "i1")
+		ingest(r, client, components.LogLevelError, "e1")
+
+		r.Eventually(func() bool { return len(mockAPIClient.getLogs()) == 2 }, time.Second, time.Millisecond)
+		r.Equal([]string{"e1", "i1"}, messages(mockAPIClient.getLogs()))
+	})
+}
+
+func Test_BatchClient_Retry(t *testing.T) {
+	t.Run("should requeue failed batches until they succeed", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &failNTimesClient{failures: 2}
+		var errs []error
+		var mu sync.Mutex
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(10*time.Millisecond),
+			components.MaxRetryBackoffWait(10*time.Millisecond),
+			components.OnError(func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			}),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+
+		r.Eventually(func() bool { return len(mockAPIClient.getLogs()) == 1 }, time.Second, time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		r.Len(errs, 2)
+		r.EqualError(errs[0], "failed to publish logs: unavailable")
+	})
+
+	t.Run("should dead-letter batches after retries are exhausted", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &flakyAPIClient{}
+		mockAPIClient.failing.Store(true)
+		deadLetters := make(chan []components.Entry, 1)
+		deadLetterErrs := make(chan error, 1)
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(10*time.Millisecond),
+			components.MaxBatchRetries(2),
+			components.MaxRetryBackoffWait(time.Millisecond),
+			components.OnError(func(error) {}),
+			components.OnDeadLetter(func(entries []components.Entry, err error) {
+				deadLetterErrs <- err
+				deadLetters <- entries
+			}),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+
+		select {
+		case entries := <-deadLetters:
+			r.Equal([]string{"m1"}, messages(entries))
+			r.EqualError(<-deadLetterErrs, "unavailable")
+		case <-time.After(time.Second):
+			r.Fail("expected dead-lettered batch")
+		}
+		r.EqualValues(3, mockAPIClient.attempts.Load())
+	})
+
+	t.Run("should drop and report batches after retries are exhausted without a dead letter", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &flakyAPIClient{}
+		mockAPIClient.failing.Store(true)
+		errs := make(chan error, 10)
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(10*time.Millisecond),
+			components.MaxBatchRetries(1),
+			components.MaxRetryBackoffWait(time.Millisecond),
+			components.OnError(func(err error) { errs <- err }),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{
+			{Level: string(components.LogLevelInfo), Message: "m1"},
+			{Level: string(components.LogLevelInfo), Message: "m2"},
+		}))
+
+		r.Eventually(func() bool {
+			return client.Stats().Dropped[string(components.LogLevelInfo)] == 2
+		}, time.Second, time.Millisecond)
+		var dropped []error
+		for len(errs) > 0 {
+			if err := <-errs; errors.Is(err, components.ErrEntriesDropped) {
+				dropped = append(dropped, err)
+			}
+		}
+		r.Len(dropped, 1, "reported once, not again with the overflow drops")
+		r.EqualError(dropped[0], "log entries dropped, batch failed: LOG_LEVEL_INFO=2: unavailable")
+	})
+
+	t.Run("should count retries against the queue limits", func(t *testing.T) {
+		r := require.New(t)
+		gate := make(chan struct{})
+		mockAPIClient := &gatedAPIClient{gate: gate, err: errors.New("unavailable")}
+		deadLetters := make(chan []components.Entry, 2)
+		deadLetterErrs := make(chan error, 2)
+		client := components.NewBatchClient(mockAPIClient,
+			components.BatchSize(10),
+			components.MaxQueuedEntries(2),
+			components.FlushInterval(time.Hour),
+			components.Overflow(components.OverflowDropNewest),
+			components.OnError(func(error) {}),
+			components.OnDeadLetter(func(entries []components.Entry, err error) {
+				deadLetterErrs <- err
+				deadLetters <- entries
+			}),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		// The error entry is sent right away and fails once the queue is full.
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Level: string(components.LogLevelError), Message: "e1"}}))
+		r.Eventually(func() bool { return client.Stats().QueuedEntries == 0 }, time.Second, time.Millisecond)
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "i1"}, {Message: "i2"}}))
+		close(gate)
+
+		select {
+		case entries := <-deadLetters:
+			r.Equal([]string{"e1"}, messages(entries))
+			err := <-deadLetterErrs
+			r.ErrorIs(err, components.ErrRetryQueueFull)
+			r.EqualError(err, "queue is full, batch not retried: unavailable")
+		case <-time.After(time.Second):
+			r.Fail("expected dead-lettered batch")
+		}
+		r.Equal(2, client.Stats().QueuedEntries)
+	})
+
+	t.Run("should dead-letter failed batches on close without retrying", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &flakyAPIClient{}
+		mockAPIClient.failing.Store(true)
+		var deadLettered []components.Entry
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(time.Hour),
+			components.OnError(func(error) {}),
+			components.OnDeadLetter(func(entries []components.Entry, _ error) {
+				deadLettered = append(deadLettered, entries...)
+			}),
+		)
+		r.NoError(client.Start(context.Background()))
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+
+		r.Error(client.Close(context.Background()))
+		r.Equal([]string{"m1"}, messages(deadLettered))
+	})
+}
+
+// failNTimesClient fails the first failures calls.
+type failNTimesClient struct {
+	apiClient
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *failNTimesClient) IngestLogs(ctx context.Context, entries []components.Entry) error {
+	if f.calls.Add(1) <= f.failures {
+		return errors.New("unavailable")
+	}
+	return f.apiClient.IngestLogs(ctx, entries)
+}
+
+func Test_BatchClient_Spool(t *testing.T) {
+	r := require.New(t)
+	spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir()})
+	r.NoError(err)
+	defer spool.Close()
+
+	mockAPIClient := &flakyAPIClient{}
+	mockAPIClient.failing.Store(true)
+	client := components.NewBatchClient(mockAPIClient,
+		components.BatchSize(1),
+		components.FlushInterval(10*time.Millisecond),
+		components.MaxBatchRetries(-1),
+		components.WithSpool(spool),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.NoError(client.Start(ctx))
+
+	for _, msg := range []string{"m1", "m2", "m3"} {
+		r.NoError(client.IngestLogs(ctx, []components.Entry{{Message: msg, Time: time.Now()}}))
+	}
+	r.Eventually(func() bool { return spool.Stats().Bytes > 0 }, time.Second, time.Millisecond)
+
+	mockAPIClient.failing.Store(false)
+	r.Eventually(func() bool { return len(mockAPIClient.getLogs()) == 3 }, time.Second, time.Millisecond)
+	r.Equal([]string{"m1", "m2", "m3"}, messages(mockAPIClient.getLogs()))
+	r.True(spool.Empty())
+}
+
+func Test_BatchClient_BatchID(t *testing.T) {
+	t.Run("should keep batch ID and sequence numbers across requeues", func(t *testing.T) {
+		r := require.New(t)
+		mockAPIClient := &batchIDRecorder{}
+		mockAPIClient.failures = 2
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(10*time.Millisecond),
+			components.MaxRetryBackoffWait(10*time.Millisecond),
+			components.OnError(func(error) {}),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}, {Message: "m2", Sequence: 42}}))
+
+		r.Eventually(func() bool { return len(mockAPIClient.getLogs()) == 2 }, time.Second, time.Millisecond)
+		ids := mockAPIClient.batchIDs()
+		r.Len(ids, 3)
+		r.NotEmpty(ids[0])
+		r.Equal([]string{ids[0], ids[0], ids[0]}, ids)
+
+		logs := mockAPIClient.getLogs()
+		r.NotZero(logs[0].Sequence)
+		r.EqualValues(42, logs[1].Sequence)
+	})
+
+	t.Run("should keep batch ID across spool replays", func(t *testing.T) {
+		r := require.New(t)
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir()})
+		r.NoError(err)
+		defer spool.Close()
+
+		mockAPIClient := &batchIDRecorder{}
+		mockAPIClient.failing.Store(true)
+		client := components.NewBatchClient(mockAPIClient,
+			components.FlushInterval(10*time.Millisecond),
+			components.MaxBatchRetries(-1),
+			components.WithSpool(spool),
+			components.OnError(func(error) {}),
+		)
+		r.NoError(client.Start(context.Background()))
+		defer client.Close(context.Background())
+
+		r.NoError(client.IngestLogs(context.Background(), []components.Entry{{Message: "m1"}}))
+		r.Eventually(func() bool { return spool.Stats().Bytes > 0 }, time.Second, time.Millisecond)
+
+		mockAPIClient.failing.Store(false)
+		r.Eventually(func() bool { return len(mockAPIClient.getLogs()) == 1 }, time.Second, time.Millisecond)
+		ids := mockAPIClient.batchIDs()
+		r.NotEmpty(ids[0])
+		for _, id := range ids {
+			r.Equal(ids[0], id)
+		}
+	})
+}
+
+// batchIDRecorder records the batch ID of every attempt. It fails the first
+// failures attempts and while failing is set.
+type batchIDRecorder struct {
+	flakyAPIClient
+	failures int32
+
+	idsMu sync.Mutex
+	ids   []string
+}
+
+func (b *batchIDRecorder) IngestLogs(ctx context.Context, entries []components.Entry) error {
+	b.idsMu.Lock()
+	b.ids = append(b.ids, components.BatchIDFromContext(ctx))
+	b.idsMu.Unlock()
+	if b.attempts.Load() < b.failures {
+		b.attempts.Add(1)
+		return errors.New("unavailable")
+	}
+	return b.flakyAPIClient.IngestLogs(ctx, entries)
+}
+
+func (b *batchIDRecorder) batchIDs() []string {
+	b.idsMu.Lock()
+	defer b.idsMu.Unlock()
+	return slices.Clone(b.ids)
+}
+
+// flakyAPIClient fails while failing is set.
+// gatedAPIClient fails with err once gate is closed.
+type gatedAPIClient struct {
+	gate chan struct{}
+	err  error
+}
+
+func (g *gatedAPIClient) IngestLogs(ctx context.Context, _ []components.Entry) error {
+	select {
+	case <-g.gate:
+		return g.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type flakyAPIClient struct {
+	apiClient
+	failing  atomic.Bool
+	attempts atomic.Int32
+}
+
+func (f *flakyAPIClient) IngestLogs(ctx context.Context, entries []components.Entry) error {
+	f.attempts.Add(1)
+	if f.failing.Load() {
+		return errors.New("unavailable")
+	}
+	return f.apiClient.IngestLogs(ctx, entries)
+}
+
+func messages(entries []components.Entry) []string {
+	res := make([]string, len(entries))
+	for i, e := range entries {
+		res[i] = e.Message
+	}
+	return res
+}
+
 type apiClient struct {
 	mu   sync.Mutex
 	logs []components.Entry
@@ -239,3 +928,11 @@ func (s *slowAPIClient) IngestLogs(ctx context.Context, entries []components.Ent
 	time.Sleep(s.delay)
 	return nil
 }
+
+// blockingAPIClient blocks until ctx is done.
+type blockingAPIClient struct{}
+
+func (blockingAPIClient) IngestLogs(ctx context.Context, _ []components.Entry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,48 @@
+package components
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+type batchIDKey struct{}
+
+// WithBatchID returns a context carrying the ID of the batch being ingested.
+// APIClientImpl sends it as the Idempotency-Key header, callers resending a
+// batch should pass the same ID so that the server can deduplicate it.
+func WithBatchID(ctx context.Context, batchID string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, batchID)
+}
+
+// BatchIDFromContext returns the batch ID set by WithBatchID, or an empty
+// string.
+func BatchIDFromContext(ctx context.Context) string {
+	batchID, _ := ctx.Value(batchIDKey{}).(string)
+	return batchID
+}
+
+// processID is generated once per process.
+var processID = rand.Text()
+
+// ProcessID returns a random ID generated when the process starts. It is
+// sent with every entry numbered by NextSequence, since sequence numbers
+// alone repeat across processes.
+func ProcessID() string {
+	return processID
+}
+
+// numberEntry assigns a sequence number to an entry that has none. Entries
+// numbered by the caller get the process ID unless they carry one.
+func numberEntry(e *Entry) {
+	if e.Sequence == 0 {
+		e.Sequence = NextSequence()
+	}
+	if e.ProcessID == "" {
+		e.ProcessID = processID
+	}
+}
+
+// NewBatchID returns a random batch ID.
+func NewBatchID() string {
+	return rand.Text()
+}
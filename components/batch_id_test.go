@@ -0,0 +1,36 @@
+package components
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchID(t *testing.T) {
+	r := require.New(t)
+	r.Empty(BatchIDFromContext(context.Background()))
+
+	ctx := WithBatchID(context.Background(), "batch-1")
+	r.Equal("batch-1", BatchIDFromContext(ctx))
+
+	a, b := NewBatchID(), NewBatchID()
+	r.NotEmpty(a)
+	r.NotEqual(a, b)
+}
+
+func TestProcessID(t *testing.T) {
+	r := require.New(t)
+	r.NotEmpty(ProcessID())
+	r.Equal(ProcessID(), ProcessID())
+
+	e := Entry{}
+	numberEntry(&e)
+	r.NotZero(e.Sequence)
+	r.Equal(ProcessID(), e.ProcessID)
+
+	e = Entry{Sequence: 7, ProcessID: "other"}
+	numberEntry(&e)
+	r.EqualValues(7, e.Sequence)
+	r.Equal("other", e.ProcessID, "numbers of other processes are kept, e.g. on spool replays")
+}
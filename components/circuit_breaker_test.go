@@ -0,0 +1,67 @@
+package components
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("should open after consecutive failures and half-open after cooldown", func(t *testing.T) {
+		r := require.New(t)
+		now := time.Unix(0, 0)
+		b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+		b.now = func() time.Time { return now }
+
+		r.True(b.allow())
+		b.record(false)
+		r.Equal(CircuitClosed, b.State())
+		r.True(b.allow())
+		b.record(false)
+		r.Equal(CircuitOpen, b.State())
+		r.False(b.allow())
+
+		now = now.Add(time.Minute)
+		r.Equal(CircuitHalfOpen, b.State())
+		r.True(b.allow(), "a single trial request is let through")
+		r.False(b.allow())
+		b.record(false)
+		r.Equal(CircuitOpen, b.State(), "a failed trial reopens the circuit")
+
+		now = now.Add(time.Minute)
+		r.True(b.allow())
+		b.record(true)
+		r.Equal(CircuitClosed, b.State())
+		r.True(b.allow())
+	})
+
+	t.Run("should reset failures on success", func(t *testing.T) {
+		r := require.New(t)
+		b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2})
+		b.record(false)
+		b.record(true)
+		b.record(false)
+		r.Equal(CircuitClosed, b.State())
+	})
+
+	t.Run("should let a new trial through when the previous one was released", func(t *testing.T) {
+		r := require.New(t)
+		b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Nanosecond})
+		b.record(false)
+		time.Sleep(time.Millisecond)
+		r.True(b.allow())
+		b.release()
+		r.True(b.allow())
+	})
+
+	t.Run("should be disabled with negative threshold", func(t *testing.T) {
+		r := require.New(t)
+		b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: -1})
+		for i := 0; i < 10; i++ {
+			b.record(false)
+		}
+		r.True(b.allow())
+		r.Equal("closed", b.State().String())
+	})
+}
@@ -10,8 +10,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,9 +32,43 @@ const (
 	LogLevelUnknown LogLevel = "LOG_LEVEL_UNKNOWN"
 )
 
+// levelName returns the short lowercase name (debug, info, warn, error) used
+// by third-party backends for an Entry level.
+func levelName(level string) string {
+	switch LogLevel(level) {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarning:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return strings.ToLower(level)
+	}
+}
+
+// epochSeconds formats t as epoch seconds with millisecond fractions, the
+// timestamp format used by Splunk HEC and GELF.
+func epochSeconds(t time.Time) json.Number {
+	return json.Number(strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64))
+}
+
+// Schema versions of IngestLogsRequest entries.
+const (
+	// SchemaVersionV1 sends only Entry.Fields with stringified values. It's
+	// the shape the existing ingestion endpoint accepts.
+	SchemaVersionV1 = "v1"
+	// SchemaVersionV2 sends Entry.Attributes with typed values instead.
+	SchemaVersionV2 = "v2"
+)
+
 type IngestLogsRequest struct {
-	Version string  `json:"version"`
-	Entries []Entry `json:"entries"`
+	Version       string  `json:"version"`
+	SchemaVersion string  `json:"schema_version,omitempty"` // Empty for SchemaVersionV1.
+	BatchID       string  `json:"batch_id,omitempty"`       // Also sent as the Idempotency-Key header.
+	Entries       []Entry `json:"entries"`
 }
 
 type Entry struct {
@@ -35,16 +76,56 @@ type Entry struct {
 	Message string            `json:"message"`
 	Time    time.Time         `json:"time"`
 	Fields  map[string]string `json:"fields"`
+	// Attributes holds the same data as Fields with typed values: strings,
+	// numbers, bools, timestamps and nested objects for groups.
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	Source  *Source `json:"source,omitempty"`
+	Logger  string  `json:"logger,omitempty"` // Logger name or group path.
+	TraceID string  `json:"trace_id,omitempty"`
+	SpanID  string  `json:"span_id,omitempty"`
+	// Sequence is a per-process monotonic number ordering entries with the
+	// same timestamp. See NextSequence.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// ProcessID identifies the process that assigned Sequence, see
+	// ProcessID.
+	ProcessID string `json:"process_id,omitempty"`
+}
+
+// Source is the location of the code that produced an entry.
+type Source struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+var sequence atomic.Uint64
+
+// NextSequence returns the next per-process entry sequence number, starting
+// at 1 in every process. Together with ProcessID, sent with every entry, it
+// identifies an entry across restarts, spool replays and replicas, so
+// backends can order entries logged within the same millisecond and
+// deduplicate retried batches.
+func NextSequence() uint64 {
+	return sequence.Add(1)
 }
 
 const (
-	headerAPIKey = "X-API-Key" // #nosec G101
+	headerAPIKey         = "X-API-Key" // #nosec G101
+	headerIdempotencyKey = "Idempotency-Key"
 )
 
 type APIClient interface {
 	IngestLogs(ctx context.Context, entries []Entry) error
 }
 
+// SchemaVersioner is implemented by clients reporting the schema version
+// they send, so that producers only build typed Entry.Attributes for
+// clients sending SchemaVersionV2.
+type SchemaVersioner interface {
+	SchemaVersion() string
+}
+
 type Config struct {
 	APIBaseURL          string
 	APIKey              string
@@ -54,13 +135,32 @@ type Config struct {
 	TLSCert             string
 	MaxRetries          int // Number of retries on failure (-1 = no retries)
 	MaxRetryBackoffWait time.Duration
+	SchemaVersion       string // SchemaVersionV1 (default) or SchemaVersionV2.
+	CircuitBreaker      CircuitBreakerConfig
+	// MaxPayloadBytes limits the compressed request body. Larger batches are
+	// split before sending. 0 means no limit.
+	MaxPayloadBytes int
+	// OnOversizedEntry is called with entries dropped because they exceed
+	// MaxPayloadBytes or are rejected with 413 on their own. Defaults to
+	// log.Printf.
+	OnOversizedEntry func(entry Entry, err error)
+	// CompressionLevel of request bodies, gzip's default level if unset.
+	CompressionLevel CompressionLevel
+	// Auth authenticates requests. Defaults to StaticAPIKey(APIKey), which
+	// is then required.
+	Auth Authenticator
 }
 
+// ErrPayloadTooLarge is reported through Config.OnOversizedEntry for entries
+// that can't be sent because the payload would exceed the size limit.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
 var _ APIClient = (*APIClientImpl)(nil)
 
 type APIClientImpl struct {
 	httpClient *http.Client
 	cfg        Config
+	breaker    *circuitBreaker
 }
 
 func NewAPIClient(cfg Config) (*APIClientImpl, error) {
@@ -73,67 +173,289 @@ func NewAPIClient(cfg Config) (*APIClientImpl, error) {
 	if cfg.MaxRetryBackoffWait == 0 {
 		cfg.MaxRetryBackoffWait = 5 * time.Second
 	}
+	if cfg.SchemaVersion == "" {
+		cfg.SchemaVersion = SchemaVersionV1
+	}
+
+	if cfg.OnOversizedEntry == nil {
+		cfg.OnOversizedEntry = func(_ Entry, err error) {
+			log.Printf("dropping log entry: %v", err)
+		}
+	}
+	if cfg.Auth == nil {
+		cfg.Auth = StaticAPIKey(cfg.APIKey)
+	}
 
 	httpClient, err := createHTTPClient(cfg.TLSCert)
 	if err != nil {
 		return nil, err
 	}
+	if tlsAuth, ok := cfg.Auth.(TLSAuthenticator); ok {
+		configureClientTLS(httpClient, tlsAuth)
+	}
 	return &APIClientImpl{
 		cfg:        cfg,
 		httpClient: httpClient,
+		breaker:    newCircuitBreaker(cfg.CircuitBreaker),
 	}, nil
 }
 
 func validateConfig(cfg Config) error {
 	if cfg.APIBaseURL == "" {
-		return errors.New("field APIBaseURL is required")
+		return &fieldError{field: "APIBaseURL", msg: "is required"}
 	}
-	if cfg.APIKey == "" {
-		return errors.New("field APIKey is required")
+	if cfg.APIKey == "" && cfg.Auth == nil {
+		return &fieldError{field: "APIKey", msg: "is required"}
 	}
 	if cfg.ClusterID == "" {
-		return errors.New("field ClusterID is required")
+		return &fieldError{field: "ClusterID", msg: "is required"}
 	}
 	if cfg.Component == "" {
-		return errors.New("field Component is required")
+		return &fieldError{field: "Component", msg: "is required"}
 	}
 	if cfg.Version == "" {
-		return errors.New("field Version is required")
+		return &fieldError{field: "Version", msg: "is required"}
+	}
+	switch cfg.SchemaVersion {
+	case "", SchemaVersionV1, SchemaVersionV2:
+	default:
+		return &fieldError{field: "SchemaVersion", msg: fmt.Sprintf("has unsupported value %q", cfg.SchemaVersion)}
+	}
+	if cfg.CompressionLevel < CompressionDefault || cfg.CompressionLevel > CompressionBest {
+		return &fieldError{field: "CompressionLevel", msg: fmt.Sprintf("has unsupported value %d", cfg.CompressionLevel)}
 	}
 	return nil
 }
 
+// fieldError is a validation error of a Config field.
+type fieldError struct {
+	field string
+	msg   string
+}
+
+func (e *fieldError) Error() string {
+	return "field " + e.field + " " + e.msg
+}
+
+// SchemaVersion returns the configured schema version.
+func (a *APIClientImpl) SchemaVersion() string {
+	return a.cfg.SchemaVersion
+}
+
+// CircuitState returns the state of the client's circuit breaker.
+func (a *APIClientImpl) CircuitState() CircuitState {
+	return a.breaker.State()
+}
+
+// IngestLogs sends entries as one batch. The batch ID is taken from ctx (see
+// WithBatchID) or generated, and stays the same across retries so that the
+// server can deduplicate a batch it already accepted. Entries without a
+// sequence number are assigned one.
 func (a *APIClientImpl) IngestLogs(ctx context.Context, entries []Entry) error {
+	batchID := BatchIDFromContext(ctx)
+	if batchID == "" {
+		batchID = NewBatchID()
+		ctx = WithBatchID(ctx, batchID)
+	}
+	buf, err := a.encode(batchID, entries)
+	if err != nil {
+		return err
+	}
+	if size := buf.Len(); a.cfg.MaxPayloadBytes > 0 && size > a.cfg.MaxPayloadBytes {
+		releaseBuffer(buf)
+		return a.split(ctx, entries, fmt.Errorf("%w: %d bytes compressed, limit is %d",
+			ErrPayloadTooLarge, size, a.cfg.MaxPayloadBytes))
+	}
+	body := newPooledBody(buf)
+	err = a.send(ctx, body)
+	body.release()
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.statusCode == http.StatusRequestEntityTooLarge {
+		return a.split(ctx, entries, fmt.Errorf("%w: %w", ErrPayloadTooLarge, err))
+	}
+	return err
+}
+
+// split bisects a batch too large to be accepted and sends the halves. A
+// single entry that is still too large is dropped and reported.
+func (a *APIClientImpl) split(ctx context.Context, entries []Entry, cause error) error {
+	if len(entries) <= 1 {
+		if len(entries) == 1 {
+			a.cfg.OnOversizedEntry(entries[0], cause)
+		}
+		return nil
+	}
+	// The halves get IDs derived from the batch ID, splitting is
+	// deterministic so they are stable across attempts too.
+	batchID := BatchIDFromContext(ctx)
+	mid := len(entries) / 2
+	if err := a.IngestLogs(WithBatchID(ctx, batchID+".0"), entries[:mid]); err != nil {
+		return err
+	}
+	return a.IngestLogs(WithBatchID(ctx, batchID+".1"), entries[mid:])
+}
+
+// encode returns the request body in a pooled buffer, which the caller puts
+// back with releaseBuffer. The body is encoded once and reused by retries.
+func (a *APIClientImpl) encode(batchID string, entries []Entry) (*bytes.Buffer, error) {
 	payload := &IngestLogsRequest{
 		Version: a.cfg.Version,
-		Entries: entries,
+		BatchID: batchID,
+		Entries: prepareEntries(entries, a.cfg.SchemaVersion),
+	}
+	if a.cfg.SchemaVersion != SchemaVersionV1 {
+		payload.SchemaVersion = a.cfg.SchemaVersion
 	}
 
-	jsonBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("marshaling ingest logs request: %w", err)
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if a.cfg.CompressionLevel == CompressionNone {
+		if err := json.NewEncoder(buf).Encode(payload); err != nil {
+			releaseBuffer(buf)
+			return nil, fmt.Errorf("marshaling ingest logs request: %w", err)
+		}
+		return buf, nil
+	}
+
+	pool := &gzipPools[a.cfg.CompressionLevel]
+	gzipWriter, _ := pool.Get().(*gzip.Writer)
+	if gzipWriter == nil {
+		var err error
+		if gzipWriter, err = gzip.NewWriterLevel(buf, a.cfg.CompressionLevel.gzipLevel()); err != nil {
+			releaseBuffer(buf)
+			return nil, err
+		}
+	} else {
+		gzipWriter.Reset(buf)
 	}
+	defer pool.Put(gzipWriter)
 
+	if err := json.NewEncoder(gzipWriter).Encode(payload); err != nil {
+		_ = gzipWriter.Close()
+		releaseBuffer(buf)
+		return nil, fmt.Errorf("marshaling ingest logs request: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// CompressionLevel selects how request bodies are compressed.
+type CompressionLevel int
+
+const (
+	// CompressionDefault uses gzip's default level.
+	CompressionDefault CompressionLevel = iota
+	// CompressionNone sends plain JSON without a Content-Encoding header.
+	CompressionNone
+	// CompressionSpeed uses gzip's fastest level.
+	CompressionSpeed
+	// CompressionBest uses gzip's smallest output level.
+	CompressionBest
+)
+
+func (l CompressionLevel) gzipLevel() int {
+	switch l {
+	case CompressionSpeed:
+		return gzip.BestSpeed
+	case CompressionBest:
+		return gzip.BestCompression
+	default:
+		return gzip.DefaultCompression
+	}
+}
+
+// maxPooledBuffer keeps buffers of unusually large batches from being held by
+// the pool.
+const maxPooledBuffer = 8 << 20
+
+var (
+	bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	// gzipPools holds reusable writers per CompressionLevel.
+	gzipPools [CompressionBest + 1]sync.Pool
+)
+
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// pooledBody is a request body backed by a pooled buffer. A transport may
+// still read or close a request body after Do returns, so the buffer goes
+// back to the pool only once the sender and every reader are done with it.
+type pooledBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+func newPooledBody(buf *bytes.Buffer) *pooledBody {
+	b := &pooledBody{buf: buf}
+	b.refs.Store(1)
+	return b
+}
+
+func (b *pooledBody) len() int {
+	return b.buf.Len()
+}
+
+// reader returns a new reader over the body, which must be closed. It also
+// serves as http.Request.GetBody.
+func (b *pooledBody) reader() (io.ReadCloser, error) {
+	for {
+		refs := b.refs.Load()
+		if refs <= 0 {
+			return nil, errors.New("request body already released")
+		}
+		if b.refs.CompareAndSwap(refs, refs+1) {
+			break
+		}
+	}
+	return &pooledBodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}, nil
+}
+
+func (b *pooledBody) release() {
+	if b.refs.Add(-1) == 0 {
+		releaseBuffer(b.buf)
+	}
+}
+
+type pooledBodyReader struct {
+	*bytes.Reader
+	body *pooledBody
+	once sync.Once
+}
+
+func (r *pooledBodyReader) Close() error {
+	r.once.Do(r.body.release)
+	return nil
+}
+
+// send posts body, retrying failures.
+func (a *APIClientImpl) send(ctx context.Context, body *pooledBody) error {
 	maxRetries := a.cfg.MaxRetries
-	backoff := 100 * time.Millisecond
 	var lastErr error
 	if maxRetries < 0 {
 		maxRetries = 0
 	}
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			waitTime := backoff * time.Duration(1<<attempt-1)
-			if waitTime > a.cfg.MaxRetryBackoffWait {
-				waitTime = a.cfg.MaxRetryBackoffWait
-			}
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(waitTime):
+			if err := a.waitRetry(ctx, attempt, lastErr); err != nil {
+				return err
 			}
 		}
 
-		err := a.doIngestRequest(ctx, jsonBytes)
+		if !a.breaker.allow() {
+			if lastErr != nil {
+				return fmt.Errorf("%w: %w", ErrCircuitOpen, lastErr)
+			}
+			return ErrCircuitOpen
+		}
+		err := a.doIngestRequest(ctx, body)
+		a.recordOutcome(ctx, err)
 		if err == nil {
 			return nil
 		}
@@ -146,47 +468,161 @@ func (a *APIClientImpl) IngestLogs(ctx context.Context, entries []Entry) error {
 	return fmt.Errorf("ingest logs failed after %d retries: %w", maxRetries, lastErr)
 }
 
+// waitRetry waits before the given retry attempt: as long as the server
+// asked for in Retry-After, or a full-jitter backoff otherwise.
+func (a *APIClientImpl) waitRetry(ctx context.Context, attempt int, lastErr error) error {
+	var httpErr *httpError
+	if errors.As(lastErr, &httpErr) && httpErr.retryAfter > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(httpErr.retryAfter):
+			return nil
+		}
+	}
+	return waitBackoff(ctx, attempt, a.cfg.MaxRetryBackoffWait)
+}
+
+// recordOutcome feeds the circuit breaker. Only retryable failures count,
+// a 4xx response means the server is up.
+func (a *APIClientImpl) recordOutcome(ctx context.Context, err error) {
+	switch {
+	case err == nil:
+		a.breaker.record(true)
+	case ctx.Err() != nil:
+		a.breaker.release()
+	default:
+		a.breaker.record(!isRetryable(err))
+	}
+}
+
+// prepareEntries returns entries shaped for the given schema version, v1
+// carries only the string Fields, v2 only the typed Attributes when set, and
+// with a sequence number assigned where missing. Entries are copied, the
+// caller's slice is left untouched.
+func prepareEntries(entries []Entry, schemaVersion string) []Entry {
+	// Skip the copy when no entry needs changes.
+	if !slices.ContainsFunc(entries, func(e Entry) bool {
+		return e.Sequence == 0 || e.ProcessID == "" || e.Attributes != nil && (schemaVersion == SchemaVersionV1 || e.Fields != nil)
+	}) {
+		return entries
+	}
+	prepared := make([]Entry, len(entries))
+	for i, e := range entries {
+		switch {
+		case schemaVersion == SchemaVersionV2 && e.Attributes != nil:
+			e.Fields = nil
+		case schemaVersion == SchemaVersionV1:
+			e.Attributes = nil
+		}
+		numberEntry(&e)
+		prepared[i] = e
+	}
+	return prepared
+}
+
 func (a *APIClientImpl) shouldRetry(err error, attempt, maxRetries int) bool {
 	if attempt >= maxRetries {
 		return false
 	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.retryAfter > a.cfg.MaxRetryBackoffWait {
+		// Don't hold the caller longer than the backoff budget, let it retry
+		// later instead.
+		return false
+	}
+	return isRetryable(err)
+}
+
+// isRetryable reports whether err is worth another attempt: transport errors,
+// 429 and 5xx responses are, any other HTTP status is not.
+func isRetryable(err error) bool {
 	var httpErr *httpError
 	if errors.As(err, &httpErr) {
-		return httpErr.statusCode >= 500
+		return httpErr.statusCode == http.StatusTooManyRequests || httpErr.statusCode >= 500
 	}
 	return true
 }
 
+// parseRetryAfter returns the delay requested by a Retry-After header given
+// in seconds or as an HTTP date, or 0.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+const retryBaseBackoff = 100 * time.Millisecond
+
+// waitBackoff blocks for the exponential backoff delay of the given retry
+// attempt, capped at maxWait, or until ctx is done.
+func waitBackoff(ctx context.Context, attempt int, maxWait time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(backoffDelay(attempt, maxWait)):
+		return nil
+	}
+}
+
+// backoffDelay returns a random delay up to the exponential backoff of the
+// given retry attempt, capped at maxWait. The full jitter keeps clients that
+// failed together from retrying in lockstep.
+func backoffDelay(attempt int, maxWait time.Duration) time.Duration {
+	waitTime := retryBaseBackoff * time.Duration(1<<attempt-1)
+	if waitTime > maxWait {
+		waitTime = maxWait
+	}
+	if waitTime <= 0 {
+		return 0
+	}
+	return rand.N(waitTime + 1)
+}
+
 type httpError struct {
 	statusCode int
 	message    string
+	retryAfter time.Duration // From the Retry-After header of 429 and 503 responses.
 }
 
 func (e *httpError) Error() string {
 	return e.message
 }
 
-func (a *APIClientImpl) doIngestRequest(ctx context.Context, jsonBytes []byte) error {
-	var compressedBuf bytes.Buffer
-	gzipWriter := gzip.NewWriter(&compressedBuf)
-	if _, err := gzipWriter.Write(jsonBytes); err != nil {
-		_ = gzipWriter.Close()
-		return err
-	}
-	if err := gzipWriter.Close(); err != nil {
+func (a *APIClientImpl) doIngestRequest(ctx context.Context, body *pooledBody) error {
+	endpoint := fmt.Sprintf("%s/v1/clusters/%s/components/%s/logs", a.cfg.APIBaseURL, a.cfg.ClusterID, a.cfg.Component)
+	reqBody, err := body.reader()
+	if err != nil {
 		return err
 	}
-
-	endpoint := fmt.Sprintf("%s/v1/clusters/%s/components/%s/logs", a.cfg.APIBaseURL, a.cfg.ClusterID, a.cfg.Component)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &compressedBuf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, reqBody)
 	if err != nil {
+		_ = reqBody.Close()
 		return err
 	}
+	req.ContentLength = int64(body.len())
+	req.GetBody = body.reader
 
-	req.Header.Set(headerAPIKey, a.cfg.APIKey)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
+	if a.cfg.CompressionLevel != CompressionNone {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if batchID := BatchIDFromContext(ctx); batchID != "" {
+		req.Header.Set(headerIdempotencyKey, batchID)
+	}
+	if err := a.cfg.Auth.Authenticate(req); err != nil {
+		_ = reqBody.Close()
+		return fmt.Errorf("authenticating request: %w", err)
+	}
 
+	// Do closes the body, possibly after it returns.
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
 		return err
@@ -195,10 +631,14 @@ func (a *APIClientImpl) doIngestRequest(ctx context.Context, jsonBytes []byte) e
 
 	if resp.StatusCode != http.StatusOK {
 		respMsg, _ := io.ReadAll(resp.Body)
-		return &httpError{
+		httpErr := &httpError{
 			statusCode: resp.StatusCode,
 			message:    fmt.Sprintf("ingest logs failed: expected status %d, got %d: %v", http.StatusOK, resp.StatusCode, string(respMsg)),
 		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			httpErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return httpErr
 	}
 	return nil
 }
@@ -225,6 +665,15 @@ func createHTTPClient(tlsCert string) (*http.Client, error) {
 	}, nil
 }
 
+// configureClientTLS lets auth take part in the TLS handshakes of client.
+func configureClientTLS(client *http.Client, auth TLSAuthenticator) {
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	auth.ConfigureTLS(transport.TLSClientConfig)
+}
+
 func createTLSConfig(tlsCert string) (*tls.Config, error) {
 	if tlsCert == "" {
 		return nil, nil
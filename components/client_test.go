@@ -5,9 +5,12 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -462,4 +465,545 @@ func TestClient_IngestLogs(t *testing.T) {
 		compressionRatio := float64(decompressedSize) / float64(compressedSize)
 		require.Greater(t, compressionRatio, 2.0, "compression ratio should be at least 2x for repetitive data")
 	})
+
+	t.Run("should shape entries by schema version", func(t *testing.T) {
+		var received []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gzipReader, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			var payload map[string]any
+			require.NoError(t, json.NewDecoder(gzipReader).Decode(&payload))
+			received = append(received, payload)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		entries := []Entry{{
+			Level:      "info",
+			Message:    "msg",
+			Time:       time.Now(),
+			Fields:     map[string]string{"n": "1.5", "ok": "true"},
+			Attributes: map[string]any{"n": 1.5, "ok": true, "g": map[string]any{"k": "v"}},
+		}}
+		for _, version := range []string{"", SchemaVersionV2} {
+			client, err := NewAPIClient(Config{
+				APIBaseURL:    server.URL,
+				APIKey:        "test-api-key",
+				ClusterID:     "cluster-123",
+				Component:     "test-component",
+				Version:       "v1.0.0",
+				SchemaVersion: version,
+			})
+			require.NoError(t, err)
+			require.NoError(t, client.IngestLogs(context.Background(), entries))
+		}
+
+		require.Len(t, received, 2)
+		v1 := received[0]
+		require.NotContains(t, v1, "schema_version")
+		v1Entry := v1["entries"].([]any)[0].(map[string]any)
+		require.Equal(t, map[string]any{"n": "1.5", "ok": "true"}, v1Entry["fields"])
+		require.NotContains(t, v1Entry, "attributes")
+
+		v2 := received[1]
+		require.Equal(t, SchemaVersionV2, v2["schema_version"])
+		v2Entry := v2["entries"].([]any)[0].(map[string]any)
+		require.Nil(t, v2Entry["fields"])
+		require.Equal(t, map[string]any{"n": 1.5, "ok": true, "g": map[string]any{"k": "v"}}, v2Entry["attributes"])
+		require.NotNil(t, entries[0].Fields, "caller entries must not be modified")
+	})
+
+	t.Run("should reject unknown schema version", func(t *testing.T) {
+		_, err := NewAPIClient(Config{
+			APIBaseURL:    "http://localhost",
+			APIKey:        "test-api-key",
+			ClusterID:     "cluster-123",
+			Component:     "test-component",
+			Version:       "v1.0.0",
+			SchemaVersion: "v3",
+		})
+		require.ErrorContains(t, err, "SchemaVersion")
+	})
+}
+
+func TestClient_RetryAfterAndCircuitBreaker(t *testing.T) {
+	newClient := func(t *testing.T, url string, cfg Config) *APIClientImpl {
+		cfg.APIBaseURL = url
+		cfg.APIKey = "test-api-key"
+		cfg.ClusterID = "cluster-123"
+		cfg.Component = "test-component"
+		cfg.Version = "v1.0.0"
+		client, err := NewAPIClient(cfg)
+		require.NoError(t, err)
+		return client
+	}
+	entries := []Entry{{Level: "info", Message: "msg", Time: time.Now()}}
+
+	t.Run("should retry 429 after the Retry-After delay", func(t *testing.T) {
+		var requests []time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, time.Now())
+			if len(requests) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, Config{MaxRetries: 1})
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+		require.Len(t, requests, 2)
+		require.GreaterOrEqual(t, requests[1].Sub(requests[0]), time.Second)
+	})
+
+	t.Run("should not wait for Retry-After beyond the backoff budget", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, Config{MaxRetries: 3, MaxRetryBackoffWait: time.Second})
+		require.Error(t, client.IngestLogs(context.Background(), entries))
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("should fail fast while the circuit is open", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, Config{
+			MaxRetries:          5,
+			MaxRetryBackoffWait: time.Millisecond,
+			CircuitBreaker:      CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Hour},
+		})
+		err := client.IngestLogs(context.Background(), entries)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Equal(t, 2, requests)
+		require.Equal(t, CircuitOpen, client.CircuitState())
+
+		require.ErrorIs(t, client.IngestLogs(context.Background(), entries), ErrCircuitOpen)
+		require.Equal(t, 2, requests)
+	})
+
+	t.Run("should not count client errors as failures", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, Config{CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 1}})
+		require.Error(t, client.IngestLogs(context.Background(), entries))
+		require.Equal(t, CircuitClosed, client.CircuitState())
+	})
+}
+
+func TestClient_PayloadLimit(t *testing.T) {
+	type received struct {
+		size     int
+		messages []string
+	}
+	newServer := func(t *testing.T, reject func(req IngestLogsRequest) bool) (*httptest.Server, *[]received) {
+		var requests []received
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+			require.NoError(t, err)
+			var req IngestLogsRequest
+			require.NoError(t, json.NewDecoder(gzipReader).Decode(&req))
+			if reject(req) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			rec := received{size: len(body)}
+			for _, e := range req.Entries {
+				rec.messages = append(rec.messages, e.Message)
+			}
+			requests = append(requests, rec)
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server, &requests
+	}
+	newClient := func(t *testing.T, url string, maxPayloadBytes int, dropped *[]Entry) *APIClientImpl {
+		client, err := NewAPIClient(Config{
+			APIBaseURL:      url,
+			APIKey:          "test-api-key",
+			ClusterID:       "cluster-123",
+			Component:       "test-component",
+			Version:         "v1.0.0",
+			MaxPayloadBytes: maxPayloadBytes,
+			OnOversizedEntry: func(entry Entry, err error) {
+				require.ErrorIs(t, err, ErrPayloadTooLarge)
+				*dropped = append(*dropped, entry)
+			},
+		})
+		require.NoError(t, err)
+		return client
+	}
+	// Random messages so that compression doesn't hide the payload size.
+	randomEntries := func(n, size int) []Entry {
+		entries := make([]Entry, n)
+		for i := range entries {
+			msg := make([]byte, size)
+			for j := range msg {
+				msg[j] = byte('a' + rand.IntN(26))
+			}
+			entries[i] = Entry{Level: "info", Message: string(msg), Time: time.Now()}
+		}
+		return entries
+	}
+	messages := func(requests []received) []string {
+		var all []string
+		for _, req := range requests {
+			all = append(all, req.messages...)
+		}
+		return all
+	}
+
+	t.Run("should split batches above the payload limit", func(t *testing.T) {
+		r := require.New(t)
+		server, requests := newServer(t, func(IngestLogsRequest) bool { return false })
+		var dropped []Entry
+		client := newClient(t, server.URL, 1500, &dropped)
+
+		entries := randomEntries(20, 200)
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Greater(len(*requests), 1)
+		for _, req := range *requests {
+			r.LessOrEqual(req.size, 1500)
+		}
+		var want []string
+		for _, e := range entries {
+			want = append(want, e.Message)
+		}
+		r.Equal(want, messages(*requests))
+		r.Empty(dropped)
+	})
+
+	t.Run("should drop single entries above the payload limit", func(t *testing.T) {
+		r := require.New(t)
+		server, requests := newServer(t, func(IngestLogsRequest) bool { return false })
+		var dropped []Entry
+		client := newClient(t, server.URL, 1500, &dropped)
+
+		entries := randomEntries(3, 100)
+		entries[1] = randomEntries(1, 4000)[0]
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Equal([]string{entries[0].Message, entries[2].Message}, messages(*requests))
+		r.Equal([]Entry{entries[1]}, dropped)
+	})
+
+	t.Run("should bisect batches rejected with 413", func(t *testing.T) {
+		r := require.New(t)
+		server, requests := newServer(t, func(req IngestLogsRequest) bool {
+			for _, e := range req.Entries {
+				if e.Message == "huge" {
+					return true
+				}
+			}
+			return len(req.Entries) > 3
+		})
+		var dropped []Entry
+		client := newClient(t, server.URL, 0, &dropped)
+
+		var entries []Entry
+		var want []string
+		for i := range 10 {
+			msg := fmt.Sprintf("msg-%d", i)
+			if i == 6 {
+				msg = "huge"
+			} else {
+				want = append(want, msg)
+			}
+			entries = append(entries, Entry{Level: "info", Message: msg, Time: time.Now()})
+		}
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Equal(want, messages(*requests))
+		r.Len(dropped, 1)
+		r.Equal("huge", dropped[0].Message)
+	})
+}
+
+func TestClient_Compression(t *testing.T) {
+	newClient := func(t *testing.T, url string, level CompressionLevel) *APIClientImpl {
+		client, err := NewAPIClient(Config{
+			APIBaseURL:          url,
+			APIKey:              "test-api-key",
+			ClusterID:           "cluster-123",
+			Component:           "test-component",
+			Version:             "v1.0.0",
+			CompressionLevel:    level,
+			MaxRetryBackoffWait: time.Millisecond,
+		})
+		require.NoError(t, err)
+		return client
+	}
+	decode := func(t *testing.T, r *http.Request) IngestLogsRequest {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gzipReader
+		}
+		var req IngestLogsRequest
+		require.NoError(t, json.NewDecoder(body).Decode(&req))
+		return req
+	}
+
+	for _, tt := range []struct {
+		name     string
+		level    CompressionLevel
+		encoding string
+	}{
+		{name: "default", level: CompressionDefault, encoding: "gzip"},
+		{name: "none", level: CompressionNone},
+		{name: "speed", level: CompressionSpeed, encoding: "gzip"},
+		{name: "best", level: CompressionBest, encoding: "gzip"},
+	} {
+		t.Run("should send with compression "+tt.name, func(t *testing.T) {
+			var received []IngestLogsRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tt.encoding, r.Header.Get("Content-Encoding"))
+				received = append(received, decode(t, r))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client := newClient(t, server.URL, tt.level)
+			for i := range 3 {
+				msg := fmt.Sprintf("msg-%d", i)
+				require.NoError(t, client.IngestLogs(context.Background(), []Entry{{Level: "info", Message: msg, Time: time.Now()}}))
+			}
+			require.Len(t, received, 3)
+			for i, req := range received {
+				require.Equal(t, fmt.Sprintf("msg-%d", i), req.Entries[0].Message)
+			}
+		})
+	}
+
+	t.Run("should resend the same body on retries", func(t *testing.T) {
+		var bodies [][]byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			bodies = append(bodies, body)
+			if len(bodies) < 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, CompressionDefault)
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{{Level: "info", Message: "msg", Time: time.Now()}}))
+		require.Len(t, bodies, 3)
+		require.Equal(t, bodies[0], bodies[1])
+		require.Equal(t, bodies[0], bodies[2])
+	})
+
+	t.Run("should not mix pooled buffers between concurrent requests", func(t *testing.T) {
+		var mu sync.Mutex
+		received := map[string]int{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := decode(t, r)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, e := range req.Entries {
+				received[e.Message]++
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := newClient(t, server.URL, CompressionSpeed)
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Go(func() {
+				entries := make([]Entry, 50)
+				for j := range entries {
+					entries[j] = Entry{Level: "info", Message: fmt.Sprintf("msg-%d-%d", i, j), Time: time.Now()}
+				}
+				require.NoError(t, client.IngestLogs(context.Background(), entries))
+			})
+		}
+		wg.Wait()
+		require.Len(t, received, 1000)
+	})
+
+	t.Run("should keep the body intact while the transport still reads it", func(t *testing.T) {
+		r := require.New(t)
+		client := newClient(t, "http://localhost", CompressionSpeed)
+		// The transport answers before reading the body, as it may on early
+		// responses or with HTTP/2, and reads it after Do returned.
+		var bodies []io.ReadCloser
+		client.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			bodies = append(bodies, req.Body)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		})
+
+		for i := range 20 {
+			r.NoError(client.IngestLogs(context.Background(), []Entry{{Level: "info", Message: fmt.Sprintf("msg-%d", i), Time: time.Now()}}))
+		}
+		r.Len(bodies, 20)
+		for i, body := range bodies {
+			gzipReader, err := gzip.NewReader(body)
+			r.NoError(err)
+			var req IngestLogsRequest
+			r.NoError(json.NewDecoder(gzipReader).Decode(&req))
+			r.Equal(fmt.Sprintf("msg-%d", i), req.Entries[0].Message)
+			r.NoError(body.Close())
+		}
+	})
+
+	t.Run("should reject unknown compression level", func(t *testing.T) {
+		_, err := NewAPIClient(Config{
+			APIBaseURL:       "http://localhost:1234",
+			APIKey:           "key",
+			ClusterID:        "clusterID",
+			Component:        "omni-agent",
+			Version:          "123",
+			CompressionLevel: 42,
+		})
+		require.EqualError(t, err, "field CompressionLevel has unsupported value 42")
+	})
+}
+
+func TestClient_BatchID(t *testing.T) {
+	type received struct {
+		header string
+		req    IngestLogsRequest
+	}
+	newServer := func(t *testing.T, handle func(req IngestLogsRequest, attempt int) int) (*httptest.Server, *[]received) {
+		var requests []received
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gzipReader, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			var req IngestLogsRequest
+			require.NoError(t, json.NewDecoder(gzipReader).Decode(&req))
+			requests = append(requests, received{header: r.Header.Get("Idempotency-Key"), req: req})
+			w.WriteHeader(handle(req, len(requests)))
+		}))
+		t.Cleanup(server.Close)
+		return server, &requests
+	}
+	newClient := func(t *testing.T, url string) *APIClientImpl {
+		client, err := NewAPIClient(Config{
+			APIBaseURL:          url,
+			APIKey:              "test-api-key",
+			ClusterID:           "cluster-123",
+			Component:           "test-component",
+			Version:             "v1.0.0",
+			MaxRetryBackoffWait: time.Millisecond,
+		})
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("should send the same batch ID and sequences on retries", func(t *testing.T) {
+		r := require.New(t)
+		server, requests := newServer(t, func(_ IngestLogsRequest, attempt int) int {
+			if attempt < 3 {
+				return http.StatusGatewayTimeout
+			}
+			return http.StatusOK
+		})
+		client := newClient(t, server.URL)
+
+		entries := []Entry{{Level: "info", Message: "m1"}, {Level: "info", Message: "m2", Sequence: 7}}
+		r.NoError(client.IngestLogs(context.Background(), entries))
+
+		r.Len(*requests, 3)
+		first := (*requests)[0]
+		r.NotEmpty(first.header)
+		r.Equal(first.header, first.req.BatchID)
+		r.NotZero(first.req.Entries[0].Sequence)
+		r.EqualValues(7, first.req.Entries[1].Sequence)
+		r.Equal(ProcessID(), first.req.Entries[0].ProcessID)
+		r.Equal(ProcessID(), first.req.Entries[1].ProcessID)
+		for _, rec := range (*requests)[1:] {
+			r.Equal(first.header, rec.header)
+			r.Equal(first.req, rec.req)
+		}
+		r.Zero(entries[0].Sequence, "caller's entries are left untouched")
+	})
+
+	t.Run("should use the batch ID from context", func(t *testing.T) {
+		server, requests := newServer(t, func(IngestLogsRequest, int) int { return http.StatusOK })
+		client := newClient(t, server.URL)
+
+		ctx := WithBatchID(context.Background(), "batch-1")
+		require.NoError(t, client.IngestLogs(ctx, []Entry{{Level: "info", Message: "m1"}}))
+		require.Equal(t, "batch-1", (*requests)[0].header)
+		require.Equal(t, "batch-1", (*requests)[0].req.BatchID)
+	})
+
+	t.Run("should derive stable IDs for split batches", func(t *testing.T) {
+		server, requests := newServer(t, func(req IngestLogsRequest, _ int) int {
+			if len(req.Entries) > 1 {
+				return http.StatusRequestEntityTooLarge
+			}
+			return http.StatusOK
+		})
+		client := newClient(t, server.URL)
+
+		ctx := WithBatchID(context.Background(), "batch-1")
+		require.NoError(t, client.IngestLogs(ctx, []Entry{{Level: "info", Message: "m1"}, {Level: "info", Message: "m2"}}))
+		var ids []string
+		for _, rec := range *requests {
+			ids = append(ids, rec.header)
+		}
+		require.Equal(t, []string{"batch-1", "batch-1.0", "batch-1.1"}, ids)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	require.Equal(t, 30*time.Second, parseRetryAfter("Mon, 01 Jan 2024 12:00:30 GMT", now))
+	require.Zero(t, parseRetryAfter("Mon, 01 Jan 2024 11:00:00 GMT", now))
+	require.Zero(t, parseRetryAfter("soon", now))
+	require.Zero(t, parseRetryAfter("", now))
+}
+
+func TestBackoffDelay(t *testing.T) {
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := backoffDelay(3, time.Second)
+		require.GreaterOrEqual(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, 700*time.Millisecond)
+		seen[d] = true
+	}
+	require.Greater(t, len(seen), 1, "delays are jittered")
+	require.LessOrEqual(t, backoffDelay(20, time.Second), time.Second)
+}
+
+func TestNextSequence(t *testing.T) {
+	first := NextSequence()
+	require.NotZero(t, first)
+	require.Equal(t, first+1, NextSequence())
+}
+
+func TestEpochSeconds(t *testing.T) {
+	require.Equal(t, "1704110400.005", epochSeconds(time.Date(2024, 1, 1, 12, 0, 0, 5_900_000, time.UTC)).String())
+	require.Equal(t, "-1.500", epochSeconds(time.Unix(-2, 500_000_000)).String())
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
 }
@@ -0,0 +1,328 @@
+package components
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ecsVersion is the Elastic Common Schema version the documents conform to.
+const ecsVersion = "8.11.0"
+
+type ElasticsearchConfig struct {
+	URL                 string // Cluster base URL, e.g. https://es.example.com:9200.
+	Index               string // Target index, may contain %Y, %m, %d and %H expanded from the entry time (UTC).
+	Username            string // Basic auth user, used together with Password.
+	Password            string
+	APIKey              string // Base64 encoded "id:api_key", sent as `Authorization: ApiKey <key>`.
+	ServiceName         string // ECS service.name attached to every document.
+	TLSCert             string
+	MaxRetries          int // Number of retries on failure (-1 = no retries)
+	MaxRetryBackoffWait time.Duration
+}
+
+var _ APIClient = (*ElasticsearchClient)(nil)
+
+// ElasticsearchClient writes entries through the Elasticsearch/OpenSearch
+// `_bulk` API as ECS documents. Items rejected with a retryable status are
+// resent; the call only succeeds once every document was accepted.
+type ElasticsearchClient struct {
+	httpClient *http.Client
+	cfg        ElasticsearchConfig
+}
+
+func NewElasticsearchClient(cfg ElasticsearchConfig) (*ElasticsearchClient, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("field URL is required")
+	}
+	if cfg.Index == "" {
+		return nil, errors.New("field Index is required")
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MaxRetryBackoffWait == 0 {
+		cfg.MaxRetryBackoffWait = 5 * time.Second
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+
+	httpClient, err := createHTTPClient(cfg.TLSCert)
+	if err != nil {
+		return nil, err
+	}
+	return &ElasticsearchClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+	}, nil
+}
+
+// BulkError is returned when some documents were still rejected by the bulk
+// API after all retries.
+type BulkError struct {
+	Failed int    // Number of rejected documents.
+	Total  int    // Number of documents in the batch.
+	Reason string // Reason reported for the first rejected document.
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("bulk ingest rejected %d of %d documents: %s", e.Failed, e.Total, e.Reason)
+}
+
+func (c *ElasticsearchClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pending := entries
+	maxRetries := max(c.cfg.MaxRetries, 0)
+	rejected := &BulkError{Total: len(entries)}
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			if err := waitBackoff(ctx, attempt, c.cfg.MaxRetryBackoffWait); err != nil {
+				return err
+			}
+		}
+
+		retry, failed, reason, err := c.doBulkRequest(ctx, pending)
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+		rejected.Failed += failed
+		if rejected.Reason == "" {
+			rejected.Reason = reason
+		}
+		pending = retry
+	}
+	if lastErr != nil {
+		return fmt.Errorf("bulk ingest failed after %d retries: %w", maxRetries, lastErr)
+	}
+	rejected.Failed += len(pending)
+	if rejected.Failed > 0 {
+		return rejected
+	}
+	return nil
+}
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error,omitempty"`
+}
+
+// doBulkRequest sends entries in a single bulk request. It returns the
+// entries whose items failed with a retryable status (429 or 5xx), the number
+// of items rejected permanently and the reason reported for the first failed
+// item.
+func (c *ElasticsearchClient) doBulkRequest(ctx context.Context, entries []Entry) ([]Entry, int, string, error) {
+	body, err := c.encodeBulk(entries)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case c.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.cfg.APIKey)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, "", &httpError{
+			statusCode: resp.StatusCode,
+			message:    fmt.Sprintf("bulk ingest failed: expected status %d, got %d: %v", http.StatusOK, resp.StatusCode, string(respBody)),
+		}
+	}
+
+	var bulkResp bulkResponse
+	if err := json.Unmarshal(respBody, &bulkResp); err != nil {
+		return nil, 0, "", fmt.Errorf("decoding bulk response: %w", err)
+	}
+	if !bulkResp.Errors {
+		return nil, 0, "", nil
+	}
+	if len(bulkResp.Items) != len(entries) {
+		return nil, 0, "", fmt.Errorf("bulk response has %d items, expected %d", len(bulkResp.Items), len(entries))
+	}
+
+	var (
+		retry    []Entry
+		rejected int
+		reason   string
+	)
+	for i, item := range bulkResp.Items {
+		for _, res := range item {
+			if res.Status < 300 {
+				continue
+			}
+			if reason == "" {
+				reason = fmt.Sprintf("status %d", res.Status)
+				if res.Error != nil {
+					reason = res.Error.Type + ": " + res.Error.Reason
+				}
+			}
+			if res.Status == http.StatusTooManyRequests || res.Status >= 500 {
+				retry = append(retry, entries[i])
+			} else {
+				rejected++
+			}
+		}
+	}
+	return retry, rejected, reason, nil
+}
+
+func (c *ElasticsearchClient) encodeBulk(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		action := map[string]map[string]string{
+			"create": {"_index": expandIndex(c.cfg.Index, e.Time)},
+		}
+		if err := enc.Encode(action); err != nil {
+			return nil, fmt.Errorf("encoding bulk action: %w", err)
+		}
+		if err := enc.Encode(c.ecsDocument(e)); err != nil {
+			return nil, fmt.Errorf("encoding bulk document: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type ecsDocument struct {
+	Timestamp time.Time         `json:"@timestamp"`
+	Message   string            `json:"message"`
+	Log       ecsLog            `json:"log"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Service   *ecsService       `json:"service,omitempty"`
+	Trace     *ecsID            `json:"trace,omitempty"`
+	Span      *ecsID            `json:"span,omitempty"`
+	Event     *ecsEvent         `json:"event,omitempty"`
+	ECS       ecsMeta           `json:"ecs"`
+}
+
+type ecsLog struct {
+	Level  string     `json:"level"`
+	Logger string     `json:"logger,omitempty"`
+	Origin *ecsOrigin `json:"origin,omitempty"`
+}
+
+type ecsOrigin struct {
+	File     ecsOriginFile `json:"file"`
+	Function string        `json:"function,omitempty"`
+}
+
+type ecsOriginFile struct {
+	Name string `json:"name,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+type ecsID struct {
+	ID string `json:"id"`
+}
+
+type ecsEvent struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+type ecsService struct {
+	Name string `json:"name"`
+}
+
+type ecsMeta struct {
+	Version string `json:"version"`
+}
+
+func (c *ElasticsearchClient) ecsDocument(e Entry) ecsDocument {
+	doc := ecsDocument{
+		Timestamp: e.Time,
+		Message:   e.Message,
+		Log:       ecsLog{Level: levelName(e.Level), Logger: e.Logger},
+		Labels:    e.Fields,
+		ECS:       ecsMeta{Version: ecsVersion},
+	}
+	if c.cfg.ServiceName != "" {
+		doc.Service = &ecsService{Name: c.cfg.ServiceName}
+	}
+	if e.Source != nil {
+		doc.Log.Origin = &ecsOrigin{
+			File:     ecsOriginFile{Name: e.Source.File, Line: e.Source.Line},
+			Function: e.Source.Function,
+		}
+	}
+	if e.TraceID != "" {
+		doc.Trace = &ecsID{ID: e.TraceID}
+	}
+	if e.SpanID != "" {
+		doc.Span = &ecsID{ID: e.SpanID}
+	}
+	if e.Sequence != 0 {
+		doc.Event = &ecsEvent{Sequence: e.Sequence}
+	}
+	return doc
+}
+
+// expandIndex replaces strftime-style date directives in pattern using t in
+// UTC. Supported directives are %Y, %m, %d, %H and %% for a literal percent.
+func expandIndex(pattern string, t time.Time) string {
+	if !strings.Contains(pattern, "%") {
+		return pattern
+	}
+	t = t.UTC()
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
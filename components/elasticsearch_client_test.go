@@ -0,0 +1,208 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticsearchClient_IngestLogs(t *testing.T) {
+	testTime := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Level: string(LogLevelInfo), Message: "msg1", Time: testTime, Fields: map[string]string{"k": "v"}},
+		{Level: string(LogLevelError), Message: "msg2", Time: testTime.Add(24 * time.Hour)},
+	}
+
+	t.Run("happy path - should send ndjson bulk request with ECS documents", func(t *testing.T) {
+		var receivedRequest *http.Request
+		var lines []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedRequest = r
+			lines = readNDJSON(t, r.Body)
+			_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{
+			URL:         server.URL + "/",
+			Index:       "logs-agent-%Y.%m.%d",
+			APIKey:      "secret",
+			ServiceName: "agent",
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+
+		require.Equal(t, "/_bulk", receivedRequest.URL.Path)
+		require.Equal(t, "application/x-ndjson", receivedRequest.Header.Get("Content-Type"))
+		require.Equal(t, "ApiKey secret", receivedRequest.Header.Get("Authorization"))
+
+		require.Len(t, lines, 4)
+		require.Equal(t, map[string]any{"create": map[string]any{"_index": "logs-agent-2024.03.07"}}, lines[0])
+		require.Equal(t, "2024-03-07T12:00:00Z", lines[1]["@timestamp"])
+		require.Equal(t, "msg1", lines[1]["message"])
+		require.Equal(t, map[string]any{"level": "info"}, lines[1]["log"])
+		require.Equal(t, map[string]any{"k": "v"}, lines[1]["labels"])
+		require.Equal(t, map[string]any{"name": "agent"}, lines[1]["service"])
+		require.Equal(t, map[string]any{"create": map[string]any{"_index": "logs-agent-2024.03.08"}}, lines[2])
+		require.Equal(t, map[string]any{"level": "error"}, lines[3]["log"])
+	})
+
+	t.Run("should retry only items rejected with retryable status", func(t *testing.T) {
+		var requests [][]map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, readNDJSON(t, r.Body))
+			if len(requests) == 1 {
+				_, _ = w.Write([]byte(`{"errors":true,"items":[
+					{"create":{"status":201}},
+					{"create":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}
+				]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{URL: server.URL, Index: "logs", Username: "u", Password: "p"})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		require.Len(t, requests[1], 2, "only the rejected document should be resent")
+		require.Equal(t, "msg2", requests[1][1]["message"])
+	})
+
+	t.Run("should return bulk error for permanently rejected items", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			_, _ = w.Write([]byte(`{"errors":true,"items":[
+				{"create":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}},
+				{"create":{"status":201}}
+			]}`))
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{URL: server.URL, Index: "logs"})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		var bulkErr *BulkError
+		require.ErrorAs(t, err, &bulkErr)
+		require.Equal(t, 1, bulkErr.Failed)
+		require.Equal(t, 2, bulkErr.Total)
+		require.Contains(t, bulkErr.Reason, "mapper_parsing_exception")
+		require.Equal(t, 1, attemptCount, "should not retry non-retryable item errors")
+	})
+
+	t.Run("should fail when retryable items are still rejected after max retries", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":503}}]}`))
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{URL: server.URL, Index: "logs", MaxRetries: 2})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries[:1])
+		var bulkErr *BulkError
+		require.ErrorAs(t, err, &bulkErr)
+		require.Equal(t, 1, bulkErr.Failed)
+		require.Equal(t, 3, attemptCount)
+	})
+
+	t.Run("should not retry on client errors (4xx)", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{URL: server.URL, Index: "logs"})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "401")
+		require.Equal(t, 1, attemptCount)
+	})
+
+	t.Run("should map source, logger, trace context and sequence to ECS fields", func(t *testing.T) {
+		var lines []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lines = readNDJSON(t, r.Body)
+			_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+		}))
+		defer server.Close()
+
+		client, err := NewElasticsearchClient(ElasticsearchConfig{URL: server.URL, Index: "logs"})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), []Entry{{
+			Level:    string(LogLevelInfo),
+			Message:  "msg",
+			Time:     testTime,
+			Source:   &Source{Function: "main.run", File: "/src/main.go", Line: 42},
+			Logger:   "agent.controller",
+			TraceID:  "trace-1",
+			SpanID:   "span-1",
+			Sequence: 7,
+		}})
+		require.NoError(t, err)
+
+		require.Len(t, lines, 2)
+		require.Equal(t, map[string]any{
+			"level":  "info",
+			"logger": "agent.controller",
+			"origin": map[string]any{
+				"file":     map[string]any{"name": "/src/main.go", "line": float64(42)},
+				"function": "main.run",
+			},
+		}, lines[1]["log"])
+		require.Equal(t, map[string]any{"id": "trace-1"}, lines[1]["trace"])
+		require.Equal(t, map[string]any{"id": "span-1"}, lines[1]["span"])
+		require.Equal(t, map[string]any{"sequence": float64(7)}, lines[1]["event"])
+	})
+}
+
+func TestExpandIndex(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 5*3600))
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "logs", want: "logs"},
+		{pattern: "logs-%Y.%m.%d", want: "logs-2024.01.01"},
+		{pattern: "logs-%Y-%m-%d-%H", want: "logs-2024-01-01-22"},
+		{pattern: "100%%-%x-%", want: "100%-%x-%"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, expandIndex(tt.pattern, ts), tt.pattern)
+	}
+}
+
+func readNDJSON(t *testing.T, r io.Reader) []map[string]any {
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
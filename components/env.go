@@ -0,0 +1,255 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envFields maps Config fields to the variables ConfigFromEnv reads them
+// from, to name the variable in validation errors.
+var envFields = map[string]string{
+	"APIBaseURL":       "API_URL",
+	"APIKey":           "API_KEY",
+	"ClusterID":        "CLUSTER_ID",
+	"Component":        "COMPONENT",
+	"Version":          "VERSION",
+	"SchemaVersion":    "SCHEMA_VERSION",
+	"CompressionLevel": "COMPRESSION",
+}
+
+// ConfigFromEnv reads a Config from environment variables, each name being
+// prefix followed by:
+//
+//	API_URL                 APIBaseURL, required
+//	API_KEY*                APIKey, required unless TLS client certificates are set
+//	CLUSTER_ID*             ClusterID, required
+//	COMPONENT               Component, required
+//	VERSION                 Version, required
+//	TLS_CA_CERT*            TLSCert, PEM encoded CA certificate
+//	TLS_CLIENT_CERT_FILE    client certificate for mTLS, with TLS_CLIENT_KEY_FILE
+//	TLS_CLIENT_KEY_FILE     client key for mTLS
+//	MAX_RETRIES             MaxRetries
+//	MAX_RETRY_BACKOFF_WAIT  MaxRetryBackoffWait, a duration such as 5s
+//	MAX_PAYLOAD_BYTES       MaxPayloadBytes
+//	SCHEMA_VERSION          SchemaVersion, v1 or v2
+//	COMPRESSION             CompressionLevel: default, none, speed or best
+//
+// Variables marked with * may instead be given as a path in a variable with
+// a _FILE suffix, e.g. CASTAI_API_KEY_FILE. The API key file is re-read when
+// it changes, see FileAPIKey. Errors name the offending variable.
+func ConfigFromEnv(prefix string) (Config, error) {
+	r := &envReader{prefix: prefix}
+	cfg := Config{
+		APIBaseURL:          r.string("API_URL"),
+		ClusterID:           r.secret("CLUSTER_ID"),
+		Component:           r.string("COMPONENT"),
+		Version:             r.string("VERSION"),
+		TLSCert:             r.secret("TLS_CA_CERT"),
+		MaxRetries:          r.int("MAX_RETRIES"),
+		MaxRetryBackoffWait: r.duration("MAX_RETRY_BACKOFF_WAIT"),
+		MaxPayloadBytes:     r.int("MAX_PAYLOAD_BYTES"),
+		SchemaVersion:       r.string("SCHEMA_VERSION"),
+		CompressionLevel:    r.compression("COMPRESSION"),
+	}
+
+	var auths []Authenticator
+	if path := r.string("API_KEY_FILE"); path != "" {
+		if r.string("API_KEY") != "" {
+			r.fail(fmt.Errorf("only one of %s and %s may be set", r.name("API_KEY"), r.name("API_KEY_FILE")))
+		}
+		// Fail early on a missing file, later reads keep the last key.
+		if _, err := os.ReadFile(path); err != nil {
+			r.fail(fmt.Errorf("reading %s: %w", r.name("API_KEY_FILE"), err))
+		}
+		auths = append(auths, FileAPIKey(path))
+	} else {
+		cfg.APIKey = r.string("API_KEY")
+	}
+	certFile, keyFile := r.string("TLS_CLIENT_CERT_FILE"), r.string("TLS_CLIENT_KEY_FILE")
+	if certFile != "" || keyFile != "" {
+		mtls, err := NewMTLSAuth(certFile, keyFile)
+		if err != nil {
+			r.fail(fmt.Errorf("%s, %s: %w", r.name("TLS_CLIENT_CERT_FILE"), r.name("TLS_CLIENT_KEY_FILE"), err))
+		}
+		auths = append(auths, mtls)
+	}
+	if len(auths) > 0 {
+		if cfg.APIKey != "" {
+			auths = append(auths, StaticAPIKey(cfg.APIKey))
+		}
+		cfg.Auth = ChainAuth(auths...)
+	}
+	if r.err != nil {
+		return Config{}, r.err
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		var fieldErr *fieldError
+		if errors.As(err, &fieldErr) {
+			if key, ok := envFields[fieldErr.field]; ok {
+				hint := r.name(key)
+				if key == "API_KEY" || key == "CLUSTER_ID" {
+					hint += " or " + r.name(key+"_FILE")
+				}
+				return Config{}, fmt.Errorf("%w: set %s", err, hint)
+			}
+		}
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// NewAPIClientFromEnv creates an APIClientImpl configured by ConfigFromEnv.
+func NewAPIClientFromEnv(prefix string) (*APIClientImpl, error) {
+	cfg, err := ConfigFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewAPIClient(cfg)
+}
+
+// BatchOptionsFromEnv reads BatchClient options from environment variables,
+// each name being prefix followed by:
+//
+//	BATCH_SIZE                BatchSize
+//	FLUSH_INTERVAL            FlushInterval, a duration such as 5s
+//	MIN_FLUSH_INTERVAL        MinFlushInterval
+//	ENQUEUE_TIMEOUT           EnqueueTimeout
+//	SHUTDOWN_TIMEOUT          ShutdownTimeout
+//	MAX_BATCH_BYTES           MaxBatchBytes
+//	MAX_QUEUED_BYTES          MaxQueuedBytes
+//	MAX_QUEUED_ENTRIES        MaxQueuedEntries
+//	CONCURRENCY               Concurrency
+//	MAX_BATCH_RETRIES         MaxBatchRetries
+//	BATCH_RETRY_BACKOFF_WAIT  MaxRetryBackoffWait
+//	OVERFLOW                  Overflow: block, drop_newest or drop_oldest
+//
+// Unset variables keep the defaults.
+func BatchOptionsFromEnv(prefix string) ([]func(*BatchClientConfig), error) {
+	r := &envReader{prefix: prefix}
+	var opts []func(*BatchClientConfig)
+	intOpt := func(key string, opt func(int) func(*BatchClientConfig)) {
+		if v := r.int(key); r.isSet(key) {
+			opts = append(opts, opt(v))
+		}
+	}
+	durationOpt := func(key string, opt func(time.Duration) func(*BatchClientConfig)) {
+		if v := r.duration(key); r.isSet(key) {
+			opts = append(opts, opt(v))
+		}
+	}
+
+	intOpt("BATCH_SIZE", BatchSize)
+	durationOpt("FLUSH_INTERVAL", FlushInterval)
+	durationOpt("MIN_FLUSH_INTERVAL", MinFlushInterval)
+	durationOpt("ENQUEUE_TIMEOUT", EnqueueTimeout)
+	durationOpt("SHUTDOWN_TIMEOUT", ShutdownTimeout)
+	intOpt("MAX_BATCH_BYTES", MaxBatchBytes)
+	intOpt("MAX_QUEUED_BYTES", MaxQueuedBytes)
+	intOpt("MAX_QUEUED_ENTRIES", MaxQueuedEntries)
+	intOpt("CONCURRENCY", Concurrency)
+	intOpt("MAX_BATCH_RETRIES", MaxBatchRetries)
+	durationOpt("BATCH_RETRY_BACKOFF_WAIT", MaxRetryBackoffWait)
+	switch v := r.string("OVERFLOW"); v {
+	case "":
+	case "block":
+		opts = append(opts, Overflow(OverflowBlock))
+	case "drop_newest":
+		opts = append(opts, Overflow(OverflowDropNewest))
+	case "drop_oldest":
+		opts = append(opts, Overflow(OverflowDropOldest))
+	default:
+		r.fail(fmt.Errorf("invalid %s %q: expected block, drop_newest or drop_oldest", r.name("OVERFLOW"), v))
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return opts, nil
+}
+
+// envReader reads prefixed variables, keeping the first parsing error.
+type envReader struct {
+	prefix string
+	err    error
+}
+
+func (r *envReader) name(key string) string {
+	return r.prefix + key
+}
+
+func (r *envReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *envReader) isSet(key string) bool {
+	return r.string(key) != ""
+}
+
+func (r *envReader) string(key string) string {
+	return strings.TrimSpace(os.Getenv(r.name(key)))
+}
+
+// secret reads key or the file named by key_FILE.
+func (r *envReader) secret(key string) string {
+	value, path := r.string(key), r.string(key+"_FILE")
+	if path == "" {
+		return value
+	}
+	if value != "" {
+		r.fail(fmt.Errorf("only one of %s and %s may be set", r.name(key), r.name(key+"_FILE")))
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.fail(fmt.Errorf("reading %s: %w", r.name(key+"_FILE"), err))
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (r *envReader) int(key string) int {
+	v := r.string(key)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid %s %q: expected an integer", r.name(key), v))
+	}
+	return n
+}
+
+func (r *envReader) duration(key string) time.Duration {
+	v := r.string(key)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid %s %q: expected a duration such as 5s", r.name(key), v))
+	}
+	return d
+}
+
+func (r *envReader) compression(key string) CompressionLevel {
+	switch v := r.string(key); v {
+	case "", "default", "gzip":
+		return CompressionDefault
+	case "none":
+		return CompressionNone
+	case "speed":
+		return CompressionSpeed
+	case "best":
+		return CompressionBest
+	default:
+		r.fail(fmt.Errorf("invalid %s %q: expected default, none, speed or best", r.name(key), v))
+		return CompressionDefault
+	}
+}
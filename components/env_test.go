@@ -0,0 +1,146 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	setRequired := func(t *testing.T) {
+		t.Setenv("CASTAI_API_URL", "https://api.cast.ai")
+		t.Setenv("CASTAI_API_KEY", "key")
+		t.Setenv("CASTAI_CLUSTER_ID", "cluster-123")
+		t.Setenv("CASTAI_COMPONENT", "agent")
+		t.Setenv("CASTAI_VERSION", "v1.0.0")
+	}
+
+	t.Run("should read config", func(t *testing.T) {
+		r := require.New(t)
+		setRequired(t)
+		t.Setenv("CASTAI_MAX_RETRIES", "5")
+		t.Setenv("CASTAI_MAX_RETRY_BACKOFF_WAIT", "2s")
+		t.Setenv("CASTAI_MAX_PAYLOAD_BYTES", "1048576")
+		t.Setenv("CASTAI_SCHEMA_VERSION", "v2")
+		t.Setenv("CASTAI_COMPRESSION", "speed")
+
+		cfg, err := ConfigFromEnv("CASTAI_")
+		r.NoError(err)
+		r.Equal("https://api.cast.ai", cfg.APIBaseURL)
+		r.Equal("key", cfg.APIKey)
+		r.Equal("cluster-123", cfg.ClusterID)
+		r.Equal("agent", cfg.Component)
+		r.Equal("v1.0.0", cfg.Version)
+		r.Equal(5, cfg.MaxRetries)
+		r.Equal(2*time.Second, cfg.MaxRetryBackoffWait)
+		r.Equal(1<<20, cfg.MaxPayloadBytes)
+		r.Equal(SchemaVersionV2, cfg.SchemaVersion)
+		r.Equal(CompressionSpeed, cfg.CompressionLevel)
+		r.Nil(cfg.Auth)
+
+		client, err := NewAPIClientFromEnv("CASTAI_")
+		r.NoError(err)
+		r.Equal(cfg.APIBaseURL, client.cfg.APIBaseURL)
+	})
+
+	t.Run("should read secrets from files", func(t *testing.T) {
+		r := require.New(t)
+		setRequired(t)
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "api-key")
+		clusterFile := filepath.Join(dir, "cluster-id")
+		r.NoError(os.WriteFile(keyFile, []byte("file-key\n"), 0o600))
+		r.NoError(os.WriteFile(clusterFile, []byte("file-cluster\n"), 0o600))
+		t.Setenv("CASTAI_API_KEY", "")
+		t.Setenv("CASTAI_API_KEY_FILE", keyFile)
+		t.Setenv("CASTAI_CLUSTER_ID", "")
+		t.Setenv("CASTAI_CLUSTER_ID_FILE", clusterFile)
+
+		cfg, err := ConfigFromEnv("CASTAI_")
+		r.NoError(err)
+		r.Equal("file-cluster", cfg.ClusterID)
+		r.Empty(cfg.APIKey)
+		r.NotNil(cfg.Auth)
+	})
+
+	t.Run("should name the missing variable", func(t *testing.T) {
+		r := require.New(t)
+		setRequired(t)
+		t.Setenv("CASTAI_API_URL", "")
+		_, err := ConfigFromEnv("CASTAI_")
+		r.EqualError(err, "field APIBaseURL is required: set CASTAI_API_URL")
+
+		setRequired(t)
+		t.Setenv("CASTAI_API_KEY", "")
+		_, err = ConfigFromEnv("CASTAI_")
+		r.EqualError(err, "field APIKey is required: set CASTAI_API_KEY or CASTAI_API_KEY_FILE")
+
+		setRequired(t)
+		t.Setenv("CASTAI_SCHEMA_VERSION", "v3")
+		_, err = ConfigFromEnv("CASTAI_")
+		r.EqualError(err, `field SchemaVersion has unsupported value "v3": set CASTAI_SCHEMA_VERSION`)
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		tests := []struct {
+			key    string
+			value  string
+			errMsg string
+		}{
+			{"CASTAI_MAX_RETRIES", "many", `invalid CASTAI_MAX_RETRIES "many": expected an integer`},
+			{"CASTAI_MAX_RETRY_BACKOFF_WAIT", "5", `invalid CASTAI_MAX_RETRY_BACKOFF_WAIT "5": expected a duration such as 5s`},
+			{"CASTAI_COMPRESSION", "zstd", `invalid CASTAI_COMPRESSION "zstd": expected default, none, speed or best`},
+			{"CASTAI_CLUSTER_ID_FILE", "/cluster-id", "only one of CASTAI_CLUSTER_ID and CASTAI_CLUSTER_ID_FILE may be set"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.key, func(t *testing.T) {
+				setRequired(t)
+				t.Setenv(tt.key, tt.value)
+				_, err := ConfigFromEnv("CASTAI_")
+				require.EqualError(t, err, tt.errMsg)
+			})
+		}
+	})
+
+	t.Run("should fail on unreadable files", func(t *testing.T) {
+		setRequired(t)
+		t.Setenv("CASTAI_API_KEY", "")
+		t.Setenv("CASTAI_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+		_, err := ConfigFromEnv("CASTAI_")
+		require.ErrorIs(t, err, os.ErrNotExist)
+		require.ErrorContains(t, err, "reading CASTAI_API_KEY_FILE")
+	})
+}
+
+func TestBatchOptionsFromEnv(t *testing.T) {
+	t.Run("should read options", func(t *testing.T) {
+		r := require.New(t)
+		t.Setenv("LOGS_BATCH_SIZE", "50")
+		t.Setenv("LOGS_FLUSH_INTERVAL", "2s")
+		t.Setenv("LOGS_CONCURRENCY", "4")
+		t.Setenv("LOGS_MAX_BATCH_RETRIES", "-1")
+		t.Setenv("LOGS_OVERFLOW", "drop_oldest")
+
+		opts, err := BatchOptionsFromEnv("LOGS_")
+		r.NoError(err)
+		var cfg BatchClientConfig
+		for _, opt := range opts {
+			opt(&cfg)
+		}
+		r.Equal(50, cfg.BatchSize)
+		r.Equal(2*time.Second, cfg.FlushInterval)
+		r.Equal(4, cfg.Concurrency)
+		r.Equal(-1, cfg.MaxBatchRetries)
+		r.Equal(OverflowDropOldest, cfg.Overflow)
+		r.Zero(cfg.ShutdownTimeout)
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		t.Setenv("LOGS_SHUTDOWN_TIMEOUT", "soon")
+		_, err := BatchOptionsFromEnv("LOGS_")
+		require.EqualError(t, err, `invalid LOGS_SHUTDOWN_TIMEOUT "soon": expected a duration such as 5s`)
+	})
+}
@@ -0,0 +1,211 @@
+package components
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+type FluentConfig struct {
+	Address string // host:port for tcp, socket path for unix.
+	Network string // "tcp" (default) or "unix".
+	Tag     string // Fluent tag the records are routed by.
+
+	// RequireAck sends a chunk ID with every batch and waits for the server
+	// to acknowledge it (the Forward protocol "chunk" option).
+	RequireAck bool
+	AckTimeout time.Duration // Defaults to 10s.
+
+	DialTimeout         time.Duration // Defaults to 5s.
+	WriteTimeout        time.Duration // Defaults to 5s.
+	MaxRetries          int           // Number of reconnect attempts on failure (-1 = no retries)
+	MaxRetryBackoffWait time.Duration
+}
+
+var _ APIClient = (*FluentClient)(nil)
+
+// fluentMaxAckSize bounds the ack response read from the server.
+const fluentMaxAckSize = 4 << 10
+
+// FluentClient sends entries to fluent-bit/fluentd using the Forward
+// protocol in Forward mode: `[tag, [[time, record], ...], options]`, with
+// EventTime timestamps carrying nanoseconds. The connection is opened lazily
+// and re-established after failures.
+type FluentClient struct {
+	cfg FluentConfig
+
+	mu        sync.Mutex
+	conn      net.Conn
+	r         *bufio.Reader
+	lastWrite time.Time // Of the last successful send on conn.
+}
+
+func NewFluentClient(cfg FluentConfig) (*FluentClient, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("field Address is required")
+	}
+	if cfg.Tag == "" {
+		return nil, errors.New("field Tag is required")
+	}
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.Network != "tcp" && cfg.Network != "unix" {
+		return nil, fmt.Errorf("unsupported network %q, expected tcp or unix", cfg.Network)
+	}
+	if cfg.AckTimeout == 0 {
+		cfg.AckTimeout = 10 * time.Second
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 5 * time.Second
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MaxRetryBackoffWait == 0 {
+		cfg.MaxRetryBackoffWait = 5 * time.Second
+	}
+	return &FluentClient{cfg: cfg}, nil
+}
+
+func (c *FluentClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var chunk string
+	if c.cfg.RequireAck {
+		var err error
+		if chunk, err = newFluentChunkID(); err != nil {
+			return err
+		}
+	}
+	msg := c.encode(entries, chunk)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && time.Since(c.lastWrite) >= connProbeIdle && !connAlive(c.conn) {
+		_ = c.closeConn()
+	}
+	maxRetries := max(c.cfg.MaxRetries, 0)
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBackoff(ctx, attempt, c.cfg.MaxRetryBackoffWait); err != nil {
+				return err
+			}
+		}
+
+		err := c.send(ctx, msg, chunk)
+		if err == nil {
+			c.lastWrite = time.Now()
+			return nil
+		}
+		lastErr = err
+		_ = c.closeConn()
+	}
+	return fmt.Errorf("fluent forward failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// Close closes the underlying connection. The client reconnects on the next
+// IngestLogs call.
+func (c *FluentClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeConn()
+}
+
+func (c *FluentClient) closeConn() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.r = nil
+	return err
+}
+
+func (c *FluentClient) send(ctx context.Context, msg []byte, chunk string) error {
+	if c.conn == nil {
+		dialer := net.Dialer{Timeout: c.cfg.DialTimeout}
+		conn, err := dialer.DialContext(ctx, c.cfg.Network, c.cfg.Address)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+		c.r = bufio.NewReader(conn)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.conn.SetWriteDeadline(ioDeadline(ctx, c.cfg.WriteTimeout)); err != nil {
+		return err
+	}
+	defer context.AfterFunc(ctx, interruptConn(c.conn))()
+	if _, err := c.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	if err := c.conn.SetReadDeadline(ioDeadline(ctx, c.cfg.AckTimeout)); err != nil {
+		return err
+	}
+	resp, err := decodeMsgpack(c.r, fluentMaxAckSize)
+	if err != nil {
+		return fmt.Errorf("reading ack: %w", err)
+	}
+	ack, ok := resp.(map[string]any)
+	if !ok || ack["ack"] != chunk {
+		return fmt.Errorf("unexpected ack response %v for chunk %s", resp, chunk)
+	}
+	return nil
+}
+
+// encode builds a Forward mode message. Entry fields are merged into the
+// record next to the level and message keys, which take precedence.
+func (c *FluentClient) encode(entries []Entry, chunk string) []byte {
+	b := make([]byte, 0, 256*len(entries))
+	b = appendMsgpackArrayHeader(b, 3)
+	b = appendMsgpackString(b, c.cfg.Tag)
+
+	b = appendMsgpackArrayHeader(b, len(entries))
+	for _, e := range entries {
+		record := make(map[string]string, len(e.Fields)+2)
+		for k, v := range e.Fields {
+			record[k] = v
+		}
+		record["level"] = levelName(e.Level)
+		record["message"] = e.Message
+
+		b = appendMsgpackArrayHeader(b, 2)
+		b = appendMsgpackEventTime(b, e.Time)
+		b = appendMsgpackStringMap(b, record)
+	}
+
+	options := map[string]any{"size": len(entries)}
+	if chunk != "" {
+		options["chunk"] = chunk
+	}
+	return appendMsgpackValue(b, options)
+}
+
+func newFluentChunkID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("generating chunk id: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(id[:]), nil
+}
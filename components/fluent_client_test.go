@@ -0,0 +1,198 @@
+package components
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFluentClient_IngestLogs(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 123_456_789, time.UTC)
+	entries := []Entry{
+		{Level: string(LogLevelInfo), Message: "msg1", Time: testTime, Fields: map[string]string{"k": "v", "message": "ignored"}},
+		{Level: string(LogLevelError), Message: "msg2", Time: testTime.Add(time.Nanosecond)},
+	}
+
+	t.Run("should send forward mode message over tcp", func(t *testing.T) {
+		server := newFakeForwardServer(t, "tcp", "127.0.0.1:0", false)
+		client, err := NewFluentClient(FluentConfig{Address: server.addr(), Tag: "agent.logs"})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+
+		msg := server.next(t)
+		require.Len(t, msg, 3)
+		require.Equal(t, "agent.logs", msg[0])
+
+		events := msg[1].([]any)
+		require.Len(t, events, 2)
+		first := events[0].([]any)
+		require.Equal(t, testTime, eventTimeFromExt(first[0].(msgpackExt)))
+		require.Equal(t, map[string]any{"level": "info", "message": "msg1", "k": "v"}, first[1])
+		second := events[1].([]any)
+		require.Equal(t, testTime.Add(time.Nanosecond), eventTimeFromExt(second[0].(msgpackExt)))
+		require.Equal(t, map[string]any{"level": "error", "message": "msg2"}, second[1])
+
+		require.Equal(t, map[string]any{"size": int64(2)}, msg[2])
+	})
+
+	t.Run("should wait for chunk ack over unix socket", func(t *testing.T) {
+		server := newFakeForwardServer(t, "unix", filepath.Join(t.TempDir(), "fluent.sock"), true)
+		client, err := NewFluentClient(FluentConfig{Address: server.addr(), Network: "unix", Tag: "agent.logs", RequireAck: true})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+
+		options := server.next(t)[2].(map[string]any)
+		require.NotEmpty(t, options["chunk"])
+	})
+
+	t.Run("should fail when ack is not received", func(t *testing.T) {
+		server := newFakeForwardServer(t, "tcp", "127.0.0.1:0", false)
+		client, err := NewFluentClient(FluentConfig{
+			Address:    server.addr(),
+			Tag:        "agent.logs",
+			RequireAck: true,
+			AckTimeout: 10 * time.Millisecond,
+			MaxRetries: 1,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.ErrorContains(t, err, "reading ack")
+		// Both attempts reached the server.
+		server.next(t)
+		server.next(t)
+	})
+
+	t.Run("should bound waiting for the ack by the context deadline", func(t *testing.T) {
+		server := newFakeForwardServer(t, "tcp", "127.0.0.1:0", false)
+		client, err := NewFluentClient(FluentConfig{
+			Address:    server.addr(),
+			Tag:        "agent.logs",
+			RequireAck: true,
+			AckTimeout: time.Minute,
+			MaxRetries: -1,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		require.ErrorContains(t, client.IngestLogs(ctx, entries), "reading ack")
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("should reconnect after server closes the connection", func(t *testing.T) {
+		server := newFakeForwardServer(t, "tcp", "127.0.0.1:0", false)
+		server.closeAfterMessage = true
+		client, err := NewFluentClient(FluentConfig{Address: server.addr(), Tag: "agent.logs"})
+		require.NoError(t, err)
+		defer client.Close()
+		probeEveryWrite(t)
+
+		for range 3 {
+			require.NoError(t, client.IngestLogs(context.Background(), entries))
+			require.Equal(t, "agent.logs", server.next(t)[0])
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should only probe connections after they were idle", func(t *testing.T) {
+		server := newFakeForwardServer(t, "tcp", "127.0.0.1:0", false)
+		client, err := NewFluentClient(FluentConfig{Address: server.addr(), Tag: "agent.logs"})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+		server.next(t)
+		conn := &readCountingConn{Conn: client.conn}
+		client.conn = conn
+
+		for range 3 {
+			require.NoError(t, client.IngestLogs(context.Background(), entries))
+			server.next(t)
+		}
+		require.Zero(t, conn.reads)
+
+		client.lastWrite = time.Now().Add(-connProbeIdle)
+		require.NoError(t, client.IngestLogs(context.Background(), entries))
+		server.next(t)
+		require.Equal(t, 1, conn.reads)
+		require.Same(t, conn, client.conn)
+	})
+
+	t.Run("should fail after max retries when server is unreachable", func(t *testing.T) {
+		client, err := NewFluentClient(FluentConfig{Address: "127.0.0.1:1", Tag: "agent.logs", MaxRetries: -1})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.ErrorContains(t, err, "fluent forward failed after 0 retries")
+	})
+}
+
+type fakeForwardServer struct {
+	ln                net.Listener
+	ack               bool
+	closeAfterMessage bool
+	messages          chan []any
+}
+
+func newFakeForwardServer(t *testing.T, network, address string, ack bool) *fakeForwardServer {
+	ln, err := net.Listen(network, address)
+	require.NoError(t, err)
+	s := &fakeForwardServer{ln: ln, ack: ack, messages: make(chan []any, 10)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeForwardServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeForwardServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				v, err := decodeMsgpack(r, 16<<20)
+				if err != nil {
+					return
+				}
+				msg := v.([]any)
+				s.messages <- msg
+				if s.ack {
+					options := msg[2].(map[string]any)
+					_, _ = conn.Write(appendMsgpackValue(nil, map[string]any{"ack": options["chunk"]}))
+				}
+				if s.closeAfterMessage {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *fakeForwardServer) next(t *testing.T) []any {
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
@@ -0,0 +1,308 @@
+package components
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gelfVersion = "1.1"
+
+	// gelfMaxChunks is the maximum number of chunks a GELF UDP message can
+	// be split into.
+	gelfMaxChunks = 128
+	// gelfChunkHeaderLen is the size of the chunk header: 2 magic bytes,
+	// 8 bytes message ID, sequence number and sequence count.
+	gelfChunkHeaderLen = 12
+)
+
+var (
+	gelfChunkMagic = []byte{0x1e, 0x0f}
+
+	errGELFMessageTooLarge = errors.New("gelf message too large")
+)
+
+type GELFConfig struct {
+	Address string // Graylog input address, host:port.
+	Network string // "udp" (default) or "tcp".
+	Host    string // GELF host field, defaults to os.Hostname().
+
+	// Compress gzips UDP messages. TCP inputs don't support compression.
+	Compress bool
+	// ChunkSize is the maximum UDP datagram size including the chunk header,
+	// defaults to 1420 bytes which fits typical network MTUs.
+	ChunkSize int
+
+	DialTimeout  time.Duration // Defaults to 5s.
+	WriteTimeout time.Duration // Defaults to 5s.
+}
+
+var _ APIClient = (*GELFClient)(nil)
+
+// GELFClient sends entries to Graylog encoded as GELF 1.1 messages, either
+// as (chunked) UDP datagrams or null byte delimited over TCP. The connection
+// is opened lazily and re-established after write failures.
+type GELFClient struct {
+	cfg GELFConfig
+
+	mu        sync.Mutex
+	conn      net.Conn
+	lastWrite time.Time // Of the last successful write on conn.
+}
+
+func NewGELFClient(cfg GELFConfig) (*GELFClient, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("field Address is required")
+	}
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.Network != "udp" && cfg.Network != "tcp" {
+		return nil, fmt.Errorf("unsupported network %q, expected udp or tcp", cfg.Network)
+	}
+	if cfg.Host == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("resolving hostname: %w", err)
+		}
+		cfg.Host = host
+	}
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = 1420
+	}
+	if cfg.ChunkSize <= gelfChunkHeaderLen {
+		return nil, fmt.Errorf("field ChunkSize must be greater than %d", gelfChunkHeaderLen)
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 5 * time.Second
+	}
+	return &GELFClient{cfg: cfg}, nil
+}
+
+func (c *GELFClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && c.cfg.Network == "tcp" && time.Since(c.lastWrite) >= connProbeIdle && !connAlive(c.conn) {
+		_ = c.closeConn()
+	}
+	for _, e := range entries {
+		msg, err := c.encode(e)
+		if err != nil {
+			return err
+		}
+		// Retry once on a fresh connection, the previous one may have been
+		// closed by the server since the last write.
+		if err := c.write(ctx, msg); err != nil {
+			if errors.Is(err, errGELFMessageTooLarge) {
+				return err
+			}
+			_ = c.closeConn()
+			if err := c.write(ctx, msg); err != nil {
+				_ = c.closeConn()
+				return fmt.Errorf("sending gelf message: %w", err)
+			}
+		}
+		c.lastWrite = time.Now()
+	}
+	return nil
+}
+
+// Close closes the underlying connection. The client reconnects on the next
+// IngestLogs call.
+func (c *GELFClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeConn()
+}
+
+func (c *GELFClient) closeConn() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *GELFClient) write(ctx context.Context, msg []byte) error {
+	if c.conn == nil {
+		dialer := net.Dialer{Timeout: c.cfg.DialTimeout}
+		conn, err := dialer.DialContext(ctx, c.cfg.Network, c.cfg.Address)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.conn.SetWriteDeadline(ioDeadline(ctx, c.cfg.WriteTimeout)); err != nil {
+		return err
+	}
+	defer context.AfterFunc(ctx, interruptConn(c.conn))()
+
+	if c.cfg.Network == "tcp" {
+		_, err := c.conn.Write(append(msg, 0))
+		return err
+	}
+
+	if c.cfg.Compress {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		if _, err := gzipWriter.Write(msg); err != nil {
+			_ = gzipWriter.Close()
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+		msg = buf.Bytes()
+	}
+	chunks, err := gelfChunks(msg, c.cfg.ChunkSize)
+	if err != nil {
+		return err
+	}
+	for _, datagram := range chunks {
+		if _, err := c.conn.Write(datagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ioDeadline returns the deadline of a read or write taking at most
+// timeout, brought forward to ctx's deadline.
+func ioDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// interruptConn returns a function failing the pending reads and writes of
+// conn, to be called when their context is cancelled.
+func interruptConn(conn net.Conn) func() {
+	return func() {
+		_ = conn.SetDeadline(time.Now())
+	}
+}
+
+// connProbeIdle is how long a stream conn must have been idle before it is
+// checked with connAlive. Peers close idle connections, and probing a busy
+// one would delay every write by the probe's read deadline.
+var connProbeIdle = time.Second
+
+// connAlive reports whether the peer hasn't closed the stream conn yet.
+// Writes to a connection closed by the peer succeed until the reset arrives,
+// so without this check the first message after a server side close would be
+// lost. It must only be used while the peer has nothing to send (GELF inputs
+// never do, Forward servers only reply with acks), any read result other than
+// a timeout means the connection is gone.
+func connAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+	var buf [1]byte
+	_, err := conn.Read(buf[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// gelfChunks splits msg into GELF UDP chunks of at most chunkSize bytes.
+// Messages that fit a single datagram are sent unchunked. Messages needing
+// more than gelfMaxChunks chunks can't be reassembled by Graylog and are
+// rejected.
+func gelfChunks(msg []byte, chunkSize int) ([][]byte, error) {
+	if len(msg) <= chunkSize {
+		return [][]byte{msg}, nil
+	}
+	payloadSize := chunkSize - gelfChunkHeaderLen
+	count := (len(msg) + payloadSize - 1) / payloadSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("%w: %d bytes need %d chunks, at most %d are allowed", errGELFMessageTooLarge, len(msg), count, gelfMaxChunks)
+	}
+
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	chunks := make([][]byte, 0, count)
+	for seq := 0; seq < count; seq++ {
+		payload := msg[seq*payloadSize : min((seq+1)*payloadSize, len(msg))]
+		chunk := make([]byte, 0, gelfChunkHeaderLen+len(payload))
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, payload...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+func (c *GELFClient) encode(e Entry) ([]byte, error) {
+	shortMessage, _, multiline := strings.Cut(e.Message, "\n")
+	msg := make(map[string]any, len(e.Fields)+6)
+	for k, v := range e.Fields {
+		msg[gelfFieldName(k)] = v
+	}
+	msg["version"] = gelfVersion
+	msg["host"] = c.cfg.Host
+	msg["short_message"] = shortMessage
+	if multiline {
+		msg["full_message"] = e.Message
+	}
+	msg["timestamp"] = epochSeconds(e.Time)
+	msg["level"] = gelfLevel(e.Level)
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("encoding gelf message: %w", err)
+	}
+	return b, nil
+}
+
+// gelfFieldName turns a field key into a GELF additional field name: it gets
+// the `_` prefix and characters outside [\w.-] are replaced with `_`. The
+// reserved `_id` becomes `_id_`.
+func gelfFieldName(key string) string {
+	name := "_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	if name == "_id" {
+		return "_id_"
+	}
+	return name
+}
+
+// gelfLevel maps an Entry level to its syslog severity number.
+func gelfLevel(level string) int {
+	switch LogLevel(level) {
+	case LogLevelDebug:
+		return 7
+	case LogLevelWarning:
+		return 4
+	case LogLevelError:
+		return 3
+	default:
+		return 6
+	}
+}
@@ -0,0 +1,243 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGELFClient_IngestLogs(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 250_000_000, time.UTC)
+	entry := Entry{
+		Level:   string(LogLevelWarning),
+		Message: "first line\nsecond line",
+		Time:    testTime,
+		Fields:  map[string]string{"g.k": "v", "id": "1", "bad key": "x"},
+	}
+
+	t.Run("should send GELF message over UDP", func(t *testing.T) {
+		conn := listenUDP(t)
+		client, err := NewGELFClient(GELFConfig{Address: conn.LocalAddr().String(), Host: "node-a"})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+
+		msg := decodeGELF(t, readDatagram(t, conn))
+		require.Equal(t, map[string]any{
+			"version":       "1.1",
+			"host":          "node-a",
+			"short_message": "first line",
+			"full_message":  "first line\nsecond line",
+			"timestamp":     1704110400.25,
+			"level":         float64(4),
+			"_g.k":          "v",
+			"_id_":          "1",
+			"_bad_key":      "x",
+		}, msg)
+	})
+
+	t.Run("should not write with a cancelled context", func(t *testing.T) {
+		conn := listenUDP(t)
+		client, err := NewGELFClient(GELFConfig{Address: conn.LocalAddr().String(), Host: "node-a"})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+		readDatagram(t, conn)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.ErrorIs(t, client.IngestLogs(ctx, []Entry{entry}), context.Canceled)
+	})
+
+	t.Run("should chunk and compress large UDP messages", func(t *testing.T) {
+		conn := listenUDP(t)
+		client, err := NewGELFClient(GELFConfig{
+			Address:   conn.LocalAddr().String(),
+			Host:      "node-a",
+			Compress:  true,
+			ChunkSize: 100,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		// Random-looking payload so gzip can't shrink it below a single chunk.
+		var sb strings.Builder
+		for i := range 200 {
+			sb.WriteString(time.Duration(i * 7919).String())
+		}
+		long := Entry{Level: string(LogLevelInfo), Message: sb.String(), Time: testTime}
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{long}))
+
+		var (
+			id      []byte
+			count   int
+			payload = map[int][]byte{}
+		)
+		for {
+			datagram := readDatagram(t, conn)
+			require.LessOrEqual(t, len(datagram), 100)
+			require.Equal(t, gelfChunkMagic, datagram[:2])
+			if id == nil {
+				id = datagram[2:10]
+				count = int(datagram[11])
+			}
+			require.Equal(t, id, datagram[2:10], "all chunks should share the message id")
+			payload[int(datagram[10])] = datagram[12:]
+			if len(payload) == count {
+				break
+			}
+		}
+		require.Greater(t, count, 1)
+		var compressed []byte
+		for seq := range count {
+			compressed = append(compressed, payload[seq]...)
+		}
+		gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		raw, err := io.ReadAll(gzipReader)
+		require.NoError(t, err)
+
+		msg := decodeGELF(t, raw)
+		require.Equal(t, long.Message, msg["short_message"])
+		require.Equal(t, float64(6), msg["level"])
+	})
+
+	t.Run("should reject messages needing too many chunks", func(t *testing.T) {
+		conn := listenUDP(t)
+		client, err := NewGELFClient(GELFConfig{Address: conn.LocalAddr().String(), ChunkSize: 13})
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = client.IngestLogs(context.Background(), []Entry{entry})
+		require.ErrorIs(t, err, errGELFMessageTooLarge)
+	})
+
+	t.Run("should send null byte delimited messages over TCP and reconnect", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		messages := make(chan []byte, 10)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				r := bufio.NewReader(conn)
+				msg, err := r.ReadBytes(0)
+				if err == nil {
+					messages <- msg[:len(msg)-1]
+				}
+				// Drop the connection after every message to force a reconnect.
+				_ = conn.Close()
+			}
+		}()
+
+		client, err := NewGELFClient(GELFConfig{Address: ln.Addr().String(), Network: "tcp", Host: "node-a"})
+		require.NoError(t, err)
+		defer client.Close()
+		probeEveryWrite(t)
+
+		for i := range 3 {
+			require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+			select {
+			case msg := <-messages:
+				require.Equal(t, "first line", decodeGELF(t, msg)["short_message"])
+			case <-time.After(time.Second):
+				t.Fatalf("message %d not received", i)
+			}
+			// Give the server time to close the connection.
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should only probe TCP connections after they were idle", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		go func() {
+			conn, err := ln.Accept()
+			if err == nil {
+				_, _ = io.Copy(io.Discard, conn)
+			}
+		}()
+
+		client, err := NewGELFClient(GELFConfig{Address: ln.Addr().String(), Network: "tcp", Host: "node-a"})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+		conn := &readCountingConn{Conn: client.conn}
+		client.conn = conn
+
+		for range 3 {
+			require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+		}
+		require.Zero(t, conn.reads)
+
+		client.lastWrite = time.Now().Add(-connProbeIdle)
+		require.NoError(t, client.IngestLogs(context.Background(), []Entry{entry}))
+		require.Equal(t, 1, conn.reads)
+		require.Same(t, conn, client.conn)
+	})
+}
+
+func TestClient_NewGELFClient(t *testing.T) {
+	_, err := NewGELFClient(GELFConfig{})
+	require.ErrorContains(t, err, "Address is required")
+	_, err = NewGELFClient(GELFConfig{Address: "localhost:12201", Network: "http"})
+	require.ErrorContains(t, err, "unsupported network")
+	client, err := NewGELFClient(GELFConfig{Address: "localhost:12201"})
+	require.NoError(t, err)
+	require.NotEmpty(t, client.cfg.Host)
+}
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func readDatagram(t *testing.T, conn *net.UDPConn) []byte {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func decodeGELF(t *testing.T, b []byte) map[string]any {
+	var msg map[string]any
+	require.NoError(t, json.Unmarshal(b, &msg))
+	return msg
+}
+
+// probeEveryWrite makes the clients probe their connection before every
+// write, for tests closing it on the server side between writes.
+func probeEveryWrite(t *testing.T) {
+	idle := connProbeIdle
+	connProbeIdle = 0
+	t.Cleanup(func() { connProbeIdle = idle })
+}
+
+// readCountingConn counts the reads on a connection.
+type readCountingConn struct {
+	net.Conn
+	reads int
+}
+
+func (c *readCountingConn) Read(b []byte) (int, error) {
+	c.reads++
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,393 @@
+package components
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// A minimal MessagePack encoder and decoder, covering what the Fluent
+// Forward protocol needs without pulling in a dependency.
+
+// msgpackExt is a decoded MessagePack extension value.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+func appendMsgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= math.MaxInt8:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// appendMsgpackEventTime encodes t as the Fluent EventTime extension (type 0)
+// carrying seconds and nanoseconds.
+func appendMsgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendMsgpackStringMap encodes m with keys in sorted order so the output
+// is deterministic.
+func appendMsgpackStringMap(b []byte, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = appendMsgpackMapHeader(b, len(keys))
+	for _, k := range keys {
+		b = appendMsgpackString(b, k)
+		b = appendMsgpackString(b, m[k])
+	}
+	return b
+}
+
+// appendMsgpackValue encodes the JSON-like value v. Types without a
+// MessagePack counterpart are encoded as their fmt representation.
+func appendMsgpackValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return appendMsgpackNil(b)
+	case bool:
+		return appendMsgpackBool(b, v)
+	case string:
+		return appendMsgpackString(b, v)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case int32:
+		return appendMsgpackInt(b, int64(v))
+	case uint64:
+		return appendMsgpackUint(b, v)
+	case uint:
+		return appendMsgpackUint(b, uint64(v))
+	case uint32:
+		return appendMsgpackUint(b, uint64(v))
+	case float64:
+		return appendMsgpackFloat(b, v)
+	case float32:
+		return appendMsgpackFloat(b, float64(v))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return appendMsgpackFloat(b, f)
+		}
+		return appendMsgpackString(b, v.String())
+	case time.Time:
+		return appendMsgpackString(b, v.Format(time.RFC3339Nano))
+	case map[string]string:
+		return appendMsgpackStringMap(b, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackMapHeader(b, len(keys))
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpackValue(b, v[k])
+		}
+		return b
+	case []any:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, e := range v {
+			b = appendMsgpackValue(b, e)
+		}
+		return b
+	default:
+		return appendMsgpackString(b, fmt.Sprintf("%v", v))
+	}
+}
+
+var (
+	errMsgpackUnsupported = errors.New("unsupported msgpack type")
+	errMsgpackTooLarge    = errors.New("msgpack length exceeds the remaining input")
+)
+
+// decodeMsgpack reads a single value of at most limit bytes from r. Maps
+// decode to map[string]any (non-string keys are formatted with fmt), arrays
+// to []any, integers to int64 or uint64, binary data to []byte and
+// extensions to msgpackExt.
+func decodeMsgpack(r *bufio.Reader, limit int) (any, error) {
+	d := &msgpackDecoder{r: r, remaining: limit}
+	return d.decode()
+}
+
+// msgpackDecoder counts the bytes left of its limit, so that lengths read
+// from the input are checked before allocating.
+type msgpackDecoder struct {
+	r         *bufio.Reader
+	remaining int
+}
+
+func (d *msgpackDecoder) decode() (any, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		b, err := d.readBytes(int(c & 0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (c - 0xcc))
+	case 0xd0:
+		n, err := d.readUint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.readUint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.readUint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.readUint(8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.readExt(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLen(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(n)
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.readBytes(n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := d.readLen(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLen(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+	return nil, fmt.Errorf("%w: 0x%x", errMsgpackUnsupported, c)
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (map[string]any, error) {
+	// Every key and value takes at least one byte.
+	if err := d.need(n, 2); err != nil {
+		return nil, err
+	}
+	m := make(map[string]any, n)
+	for range n {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprintf("%v", k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int) ([]any, error) {
+	if err := d.need(n, 1); err != nil {
+		return nil, err
+	}
+	a := make([]any, 0, n)
+	for range n {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) readExt(n int) (msgpackExt, error) {
+	typ, err := d.readByte()
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	data, err := d.readBytes(n)
+	return msgpackExt{Type: int8(typ), Data: data}, err
+}
+
+func (d *msgpackDecoder) readLen(size int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(d.remaining) {
+		return 0, errMsgpackTooLarge
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if err := d.need(1, 1); err != nil {
+		return 0, err
+	}
+	d.remaining--
+	return d.r.ReadByte()
+}
+
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	if err := d.need(n, 1); err != nil {
+		return nil, err
+	}
+	d.remaining -= n
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+// need checks that n items of at least size bytes each fit in the
+// remaining input.
+func (d *msgpackDecoder) need(n, size int) error {
+	if n > d.remaining/size {
+		return errMsgpackTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgpack_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{name: "nil", in: nil, want: nil},
+		{name: "bool", in: true, want: true},
+		{name: "positive fixint", in: 7, want: int64(7)},
+		{name: "negative fixint", in: -7, want: int64(-7)},
+		{name: "int8", in: -100, want: int64(-100)},
+		{name: "int16", in: -1000, want: int64(-1000)},
+		{name: "int32", in: int64(math.MinInt32), want: int64(math.MinInt32)},
+		{name: "int64", in: int64(math.MinInt64), want: int64(math.MinInt64)},
+		{name: "uint8", in: 200, want: uint64(200)},
+		{name: "uint16", in: 60000, want: uint64(60000)},
+		{name: "uint32", in: uint64(math.MaxUint32), want: uint64(math.MaxUint32)},
+		{name: "uint64", in: uint64(math.MaxUint64), want: uint64(math.MaxUint64)},
+		{name: "float", in: 1.25, want: 1.25},
+		{name: "json number", in: json.Number("42"), want: int64(42)},
+		{name: "fixstr", in: "meow", want: "meow"},
+		{name: "str8", in: strings.Repeat("a", 200), want: strings.Repeat("a", 200)},
+		{name: "str16", in: strings.Repeat("a", 70000), want: strings.Repeat("a", 70000)},
+		{name: "array", in: []any{"a", 1, false}, want: []any{"a", int64(1), false}},
+		{name: "string map", in: map[string]string{"k": "v"}, want: map[string]any{"k": "v"}},
+		{
+			name: "nested map",
+			in:   map[string]any{"a": map[string]any{"b": []any{1.5}}},
+			want: map[string]any{"a": map[string]any{"b": []any{1.5}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := appendMsgpackValue(nil, tt.in)
+			got, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b)), len(b))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMsgpack_LargeCollections(t *testing.T) {
+	arr := make([]any, 20)
+	m := make(map[string]any, 20)
+	for i := range arr {
+		arr[i] = int64(i)
+		m[strings.Repeat("k", i+1)] = int64(i)
+	}
+	b := appendMsgpackValue(nil, map[string]any{"arr": arr, "map": m})
+	got, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b)), len(b))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"arr": arr, "map": m}, got)
+}
+
+func TestMsgpack_LengthBeyondInput(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "array32", in: []byte{0xdd, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{name: "map32", in: []byte{0xdf, 0xff, 0xff, 0xff, 0xff, 0x01, 0x01}},
+		{name: "fixmap", in: []byte{0x8f, 0x01}},
+		{name: "bin32", in: []byte{0xc6, 0xff, 0xff, 0xff, 0xff}},
+		{name: "str32", in: []byte{0xdb, 0x7f, 0xff, 0xff, 0xff, 'a'}},
+		{name: "ext32", in: []byte{0xc9, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{name: "nested", in: []byte{0x91, 0xdc, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(tt.in)), len(tt.in))
+			require.ErrorIs(t, err, errMsgpackTooLarge)
+		})
+	}
+
+	t.Run("should bound a stream by the limit", func(t *testing.T) {
+		b := appendMsgpackValue(nil, strings.Repeat("a", 100))
+		_, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b)), 50)
+		require.ErrorIs(t, err, errMsgpackTooLarge)
+	})
+}
+
+func TestMsgpack_EventTime(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 123_456_789, time.UTC)
+	b := appendMsgpackEventTime(nil, ts)
+	require.Len(t, b, 10)
+
+	got, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b)), len(b))
+	require.NoError(t, err)
+	ext, ok := got.(msgpackExt)
+	require.True(t, ok)
+	require.Equal(t, int8(0), ext.Type)
+	require.Equal(t, ts, eventTimeFromExt(ext))
+}
+
+func eventTimeFromExt(ext msgpackExt) time.Time {
+	sec := uint32(ext.Data[0])<<24 | uint32(ext.Data[1])<<16 | uint32(ext.Data[2])<<8 | uint32(ext.Data[3])
+	nsec := uint32(ext.Data[4])<<24 | uint32(ext.Data[5])<<16 | uint32(ext.Data[6])<<8 | uint32(ext.Data[7])
+	return time.Unix(int64(sec), int64(nsec)).UTC()
+}
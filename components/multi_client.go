@@ -0,0 +1,233 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MultiClientMode selects how MultiClient spreads batches over endpoints.
+type MultiClientMode int
+
+const (
+	// MultiClientFailover sends each batch to the first healthy endpoint in
+	// order. Failed endpoints are skipped until ProbeInterval passes, after
+	// which they are probed and preferred again once they recover.
+	MultiClientFailover MultiClientMode = iota
+	// MultiClientMirror sends each batch to all endpoints concurrently. It
+	// succeeds when at least Quorum endpoints accept it.
+	MultiClientMirror
+)
+
+// Endpoint is a named APIClient used by MultiClient.
+type Endpoint struct {
+	Name   string // Used in errors, defaults to the endpoint's index.
+	Client APIClient
+}
+
+var DefaultMultiClientConfig = MultiClientConfig{
+	Mode:          MultiClientFailover,
+	ProbeInterval: 30 * time.Second,
+}
+
+type MultiClientConfig struct {
+	// Endpoints in order of preference.
+	Endpoints []Endpoint
+	Mode      MultiClientMode
+	// Quorum is the number of endpoints that must accept a batch in mirror
+	// mode. Defaults to all of them.
+	Quorum int
+	// ProbeInterval is how long a failed endpoint is skipped in failover
+	// mode before it's tried again.
+	ProbeInterval time.Duration
+	// Probe checks whether a failed endpoint has recovered before a batch is
+	// sent to it again. Defaults to trying the batch itself.
+	Probe func(ctx context.Context, client APIClient) error
+}
+
+// MultiClient is an APIClient combining several endpoints, which may be any
+// APIClient implementations, with failover or mirroring.
+type MultiClient struct {
+	cfg MultiClientConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	downUntil []time.Time // Zero for healthy endpoints.
+}
+
+var _ APIClient = (*MultiClient)(nil)
+
+func NewMultiClient(cfg MultiClientConfig) (*MultiClient, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("field Endpoints is required")
+	}
+	for i := range cfg.Endpoints {
+		if cfg.Endpoints[i].Client == nil {
+			return nil, fmt.Errorf("field Endpoints[%d].Client is required", i)
+		}
+	}
+	switch cfg.Mode {
+	case MultiClientFailover, MultiClientMirror:
+	default:
+		return nil, fmt.Errorf("field Mode has unsupported value %d", cfg.Mode)
+	}
+	if cfg.Quorum == 0 {
+		cfg.Quorum = len(cfg.Endpoints)
+	}
+	if cfg.Quorum < 0 || cfg.Quorum > len(cfg.Endpoints) {
+		return nil, fmt.Errorf("field Quorum must be between 1 and %d", len(cfg.Endpoints))
+	}
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = DefaultMultiClientConfig.ProbeInterval
+	}
+
+	endpoints := make([]Endpoint, len(cfg.Endpoints))
+	for i, e := range cfg.Endpoints {
+		if e.Name == "" {
+			e.Name = strconv.Itoa(i)
+		}
+		endpoints[i] = e
+	}
+	cfg.Endpoints = endpoints
+
+	return &MultiClient{
+		cfg:       cfg,
+		now:       time.Now,
+		downUntil: make([]time.Time, len(endpoints)),
+	}, nil
+}
+
+func (m *MultiClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	if m.cfg.Mode == MultiClientMirror {
+		return m.mirror(ctx, entries)
+	}
+	return m.failover(ctx, entries)
+}
+
+// SchemaVersion returns SchemaVersionV2 if any endpoint sends it. Endpoints
+// sending SchemaVersionV1 drop the typed attributes.
+func (m *MultiClient) SchemaVersion() string {
+	for _, e := range m.cfg.Endpoints {
+		if v, ok := e.Client.(SchemaVersioner); ok && v.SchemaVersion() == SchemaVersionV2 {
+			return SchemaVersionV2
+		}
+	}
+	return SchemaVersionV1
+}
+
+// Healthy reports for each endpoint whether it's currently used in failover
+// mode.
+func (m *MultiClient) Healthy() []bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	healthy := make([]bool, len(m.downUntil))
+	for i, until := range m.downUntil {
+		healthy[i] = until.IsZero()
+	}
+	return healthy
+}
+
+func (m *MultiClient) failover(ctx context.Context, entries []Entry) error {
+	var errs []error
+	var skipped []int
+	for i := range m.cfg.Endpoints {
+		down, probe := m.status(i)
+		if down && !probe {
+			skipped = append(skipped, i)
+			continue
+		}
+		err := m.send(ctx, i, entries, probe)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	// Rather than dropping the batch, try endpoints waiting to be probed
+	// when all others failed.
+	for _, i := range skipped {
+		err := m.send(ctx, i, entries, false)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("all endpoints failed: %w", errors.Join(errs...))
+}
+
+// send ingests entries to endpoint i, probing it first if requested, and
+// updates its health.
+func (m *MultiClient) send(ctx context.Context, i int, entries []Entry, probe bool) error {
+	endpoint := m.cfg.Endpoints[i]
+	if probe && m.cfg.Probe != nil {
+		if err := m.cfg.Probe(ctx, endpoint.Client); err != nil {
+			if ctx.Err() == nil {
+				m.markDown(i)
+			}
+			return fmt.Errorf("endpoint %s: probe: %w", endpoint.Name, err)
+		}
+	}
+	if err := endpoint.Client.IngestLogs(ctx, entries); err != nil {
+		if ctx.Err() == nil {
+			m.markDown(i)
+		}
+		return fmt.Errorf("endpoint %s: %w", endpoint.Name, err)
+	}
+	m.markUp(i)
+	return nil
+}
+
+// status reports whether endpoint i is down and whether it's due for a
+// probe.
+func (m *MultiClient) status(i int) (down, probe bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until := m.downUntil[i]
+	if until.IsZero() {
+		return false, false
+	}
+	return true, !m.now().Before(until)
+}
+
+func (m *MultiClient) markDown(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.downUntil[i] = m.now().Add(m.cfg.ProbeInterval)
+}
+
+func (m *MultiClient) markUp(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.downUntil[i] = time.Time{}
+}
+
+func (m *MultiClient) mirror(ctx context.Context, entries []Entry) error {
+	errs := make([]error, len(m.cfg.Endpoints))
+	var wg sync.WaitGroup
+	for i := range m.cfg.Endpoints {
+		wg.Go(func() {
+			errs[i] = m.send(ctx, i, entries, false)
+		})
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, err := range errs {
+		if err == nil {
+			accepted++
+		}
+	}
+	if accepted >= m.cfg.Quorum {
+		return nil
+	}
+	return fmt.Errorf("%d of %d endpoints accepted the batch, quorum is %d: %w",
+		accepted, len(errs), m.cfg.Quorum, errors.Join(errs...))
+}
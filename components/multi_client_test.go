@@ -0,0 +1,201 @@
+package components_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging/components"
+)
+
+func TestMultiClient(t *testing.T) {
+	batch := []components.Entry{{Level: "info", Message: "msg", Time: time.Now()}}
+
+	t.Run("should fail over and fail back after probing", func(t *testing.T) {
+		r := require.New(t)
+		primary, secondary := &endpointClient{}, &endpointClient{}
+		client, err := components.NewMultiClient(components.MultiClientConfig{
+			Endpoints: []components.Endpoint{
+				{Name: "eu", Client: primary},
+				{Name: "us", Client: secondary},
+			},
+			ProbeInterval: 50 * time.Millisecond,
+		})
+		r.NoError(err)
+
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.Equal(1, primary.accepted())
+
+		primary.fail.Store(true)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.Equal(1, secondary.accepted())
+		r.Equal([]bool{false, true}, client.Healthy())
+
+		// The failed primary is skipped until the probe interval passes.
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.EqualValues(2, primary.attempts.Load())
+		r.Equal(2, secondary.accepted())
+
+		primary.fail.Store(false)
+		time.Sleep(60 * time.Millisecond)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.Equal(2, primary.accepted())
+		r.Equal(2, secondary.accepted())
+		r.Equal([]bool{true, true}, client.Healthy())
+	})
+
+	t.Run("should probe recovered endpoints before sending", func(t *testing.T) {
+		r := require.New(t)
+		primary, secondary := &endpointClient{}, &endpointClient{}
+		var probes atomic.Int32
+		var recovered atomic.Bool
+		client, err := components.NewMultiClient(components.MultiClientConfig{
+			Endpoints:     []components.Endpoint{{Client: primary}, {Client: secondary}},
+			ProbeInterval: time.Millisecond,
+			Probe: func(ctx context.Context, c components.APIClient) error {
+				probes.Add(1)
+				r.Same(primary, c)
+				if !recovered.Load() {
+					return errors.New("still down")
+				}
+				return nil
+			},
+		})
+		r.NoError(err)
+
+		primary.fail.Store(true)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		primary.fail.Store(false)
+
+		time.Sleep(5 * time.Millisecond)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.EqualValues(1, probes.Load())
+		r.Equal(0, primary.accepted())
+		r.Equal(2, secondary.accepted())
+
+		recovered.Store(true)
+		time.Sleep(5 * time.Millisecond)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.EqualValues(2, probes.Load())
+		r.Equal(1, primary.accepted())
+	})
+
+	t.Run("should try endpoints waiting for a probe when all others fail", func(t *testing.T) {
+		r := require.New(t)
+		primary, secondary := &endpointClient{}, &endpointClient{}
+		client, err := components.NewMultiClient(components.MultiClientConfig{
+			Endpoints: []components.Endpoint{
+				{Name: "eu", Client: primary},
+				{Name: "us", Client: secondary},
+			},
+			ProbeInterval: time.Hour,
+		})
+		r.NoError(err)
+
+		primary.fail.Store(true)
+		secondary.fail.Store(true)
+		err = client.IngestLogs(context.Background(), batch)
+		r.ErrorContains(err, "endpoint eu: unavailable")
+		r.ErrorContains(err, "endpoint us: unavailable")
+
+		secondary.fail.Store(false)
+		r.NoError(client.IngestLogs(context.Background(), batch))
+		r.Equal(1, secondary.accepted())
+	})
+
+	t.Run("should mirror batches and apply the quorum", func(t *testing.T) {
+		r := require.New(t)
+		clients := []*endpointClient{{}, {}, {}}
+		endpoints := make([]components.Endpoint, len(clients))
+		for i, c := range clients {
+			endpoints[i] = components.Endpoint{Client: c}
+		}
+		clients[2].fail.Store(true)
+
+		all, err := components.NewMultiClient(components.MultiClientConfig{
+			Endpoints: endpoints,
+			Mode:      components.MultiClientMirror,
+		})
+		r.NoError(err)
+		err = all.IngestLogs(context.Background(), batch)
+		r.ErrorContains(err, "2 of 3 endpoints accepted the batch, quorum is 3")
+		r.ErrorContains(err, "endpoint 2: unavailable")
+
+		quorum, err := components.NewMultiClient(components.MultiClientConfig{
+			Endpoints: endpoints,
+			Mode:      components.MultiClientMirror,
+			Quorum:    2,
+		})
+		r.NoError(err)
+		r.NoError(quorum.IngestLogs(context.Background(), batch))
+
+		for _, c := range clients[:2] {
+			r.Equal(2, c.accepted())
+		}
+		r.EqualValues(2, clients[2].attempts.Load())
+	})
+
+	t.Run("should validate config", func(t *testing.T) {
+		r := require.New(t)
+		_, err := components.NewMultiClient(components.MultiClientConfig{})
+		r.EqualError(err, "field Endpoints is required")
+		_, err = components.NewMultiClient(components.MultiClientConfig{Endpoints: []components.Endpoint{{}}})
+		r.EqualError(err, "field Endpoints[0].Client is required")
+		_, err = components.NewMultiClient(components.MultiClientConfig{
+			Endpoints: []components.Endpoint{{Client: &endpointClient{}}},
+			Quorum:    2,
+		})
+		r.EqualError(err, "field Quorum must be between 1 and 1")
+	})
+
+	t.Run("should report the v2 schema if any endpoint sends it", func(t *testing.T) {
+		r := require.New(t)
+		v1 := components.NewBatchClient(&endpointClient{})
+		v2, err := components.NewAPIClient(components.Config{
+			APIBaseURL:    "http://localhost",
+			APIKey:        "key",
+			ClusterID:     "cluster",
+			Component:     "component",
+			Version:       "v1.0.0",
+			SchemaVersion: components.SchemaVersionV2,
+		})
+		r.NoError(err)
+
+		client, err := components.NewMultiClient(components.MultiClientConfig{Endpoints: []components.Endpoint{{Client: v1}}})
+		r.NoError(err)
+		r.Equal(components.SchemaVersionV1, client.SchemaVersion())
+		client, err = components.NewMultiClient(components.MultiClientConfig{Endpoints: []components.Endpoint{{Client: v1}, {Client: v2}}})
+		r.NoError(err)
+		r.Equal(components.SchemaVersionV2, client.SchemaVersion())
+	})
+}
+
+type endpointClient struct {
+	fail     atomic.Bool
+	attempts atomic.Int32
+
+	mu      sync.Mutex
+	batches [][]components.Entry
+}
+
+func (c *endpointClient) IngestLogs(_ context.Context, entries []components.Entry) error {
+	c.attempts.Add(1)
+	if c.fail.Load() {
+		return errors.New("unavailable")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches = append(c.batches, entries)
+	return nil
+}
+
+func (c *endpointClient) accepted() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.batches)
+}
@@ -0,0 +1,240 @@
+package components
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerSplunkChannel = "X-Splunk-Request-Channel"
+
+	splunkEventPath = "/services/collector/event"
+	splunkAckPath   = "/services/collector/ack"
+)
+
+type SplunkConfig struct {
+	URL                 string // HEC base URL, e.g. https://splunk.example.com:8088.
+	Token               string // HEC token, sent as `Authorization: Splunk <token>`.
+	Index               string // Optional, defaults to the token's default index.
+	SourceType          string
+	Source              string
+	Host                string
+	TLSCert             string
+	MaxRetries          int // Number of retries on failure (-1 = no retries)
+	MaxRetryBackoffWait time.Duration
+
+	// AckChannel enables indexer acknowledgement when set. It must be a GUID
+	// and the token must have acknowledgement enabled. IngestLogs then only
+	// returns once Splunk confirms the batch was indexed.
+	AckChannel      string
+	AckTimeout      time.Duration // How long to wait for the acknowledgement, defaults to 30s.
+	AckPollInterval time.Duration // How often to poll for the acknowledgement, defaults to 1s.
+}
+
+var _ APIClient = (*SplunkClient)(nil)
+
+// SplunkClient sends entries to the Splunk HTTP Event Collector.
+type SplunkClient struct {
+	httpClient *http.Client
+	cfg        SplunkConfig
+}
+
+func NewSplunkClient(cfg SplunkConfig) (*SplunkClient, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("field URL is required")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("field Token is required")
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MaxRetryBackoffWait == 0 {
+		cfg.MaxRetryBackoffWait = 5 * time.Second
+	}
+	if cfg.AckTimeout == 0 {
+		cfg.AckTimeout = 30 * time.Second
+	}
+	if cfg.AckPollInterval == 0 {
+		cfg.AckPollInterval = time.Second
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+
+	httpClient, err := createHTTPClient(cfg.TLSCert)
+	if err != nil {
+		return nil, err
+	}
+	return &SplunkClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+	}, nil
+}
+
+type splunkEvent struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	SourceType string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      splunkEventBody   `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type splunkEventBody struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId,omitempty"`
+}
+
+func (c *SplunkClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range entries {
+		if err := enc.Encode(c.event(e)); err != nil {
+			return fmt.Errorf("encoding splunk event: %w", err)
+		}
+	}
+	payload := body.Bytes()
+
+	maxRetries := max(c.cfg.MaxRetries, 0)
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBackoff(ctx, attempt, c.cfg.MaxRetryBackoffWait); err != nil {
+				return err
+			}
+		}
+
+		err := c.send(ctx, payload)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("splunk ingest failed after %d retries: %w", maxRetries, lastErr)
+}
+
+func (c *SplunkClient) event(e Entry) splunkEvent {
+	return splunkEvent{
+		Time:       epochSeconds(e.Time),
+		Host:       c.cfg.Host,
+		Source:     c.cfg.Source,
+		SourceType: c.cfg.SourceType,
+		Index:      c.cfg.Index,
+		Event: splunkEventBody{
+			Message: e.Message,
+			Level:   levelName(e.Level),
+		},
+		Fields: e.Fields,
+	}
+}
+
+// send posts a single payload and, when acknowledgement is enabled, waits for
+// Splunk to confirm it was indexed.
+func (c *SplunkClient) send(ctx context.Context, payload []byte) error {
+	resp, err := c.do(ctx, splunkEventPath, payload)
+	if err != nil {
+		return err
+	}
+	if c.cfg.AckChannel == "" {
+		return nil
+	}
+	if resp.AckID == nil {
+		return errors.New("splunk response has no ackId, is acknowledgement enabled for the token?")
+	}
+	return c.waitForAck(ctx, *resp.AckID)
+}
+
+func (c *SplunkClient) waitForAck(ctx context.Context, ackID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.AckTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(c.cfg.AckPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for splunk ack %d: %w", ackID, ctx.Err())
+		case <-ticker.C:
+		}
+
+		var ackResp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := c.doJSON(ctx, splunkAckPath+"?channel="+url.QueryEscape(c.cfg.AckChannel), body, &ackResp); err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			continue
+		}
+		if ackResp.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+	}
+}
+
+func (c *SplunkClient) do(ctx context.Context, path string, body []byte) (*splunkResponse, error) {
+	var resp splunkResponse
+	if err := c.doJSON(ctx, path, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *SplunkClient) doJSON(ctx context.Context, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+c.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.AckChannel != "" {
+		req.Header.Set(headerSplunkChannel, c.cfg.AckChannel)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpError{
+			statusCode: resp.StatusCode,
+			message:    fmt.Sprintf("splunk request failed: expected status %d, got %d: %v", http.StatusOK, resp.StatusCode, string(respBody)),
+		}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("decoding splunk response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplunkClient_IngestLogs(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 123_456_789, time.UTC)
+	entries := []Entry{
+		{Level: string(LogLevelWarning), Message: "msg1", Time: testTime, Fields: map[string]string{"k": "v"}},
+		{Level: string(LogLevelInfo), Message: "msg2", Time: testTime},
+	}
+
+	t.Run("happy path - should send events with token auth and metadata", func(t *testing.T) {
+		var receivedRequest *http.Request
+		var events []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedRequest = r
+			dec := json.NewDecoder(r.Body)
+			for dec.More() {
+				var ev map[string]any
+				require.NoError(t, dec.Decode(&ev))
+				events = append(events, ev)
+			}
+			_, _ = w.Write([]byte(`{"text":"Success","code":0}`))
+		}))
+		defer server.Close()
+
+		client, err := NewSplunkClient(SplunkConfig{
+			URL:        server.URL,
+			Token:      "hec-token",
+			Index:      "agents",
+			SourceType: "castai:agent",
+			Source:     "agent",
+			Host:       "node-a",
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+
+		require.Equal(t, "/services/collector/event", receivedRequest.URL.Path)
+		require.Equal(t, "Splunk hec-token", receivedRequest.Header.Get("Authorization"))
+		require.Empty(t, receivedRequest.Header.Get("X-Splunk-Request-Channel"))
+
+		require.Len(t, events, 2)
+		require.Equal(t, 1704110400.123, events[0]["time"])
+		require.Equal(t, "agents", events[0]["index"])
+		require.Equal(t, "castai:agent", events[0]["sourcetype"])
+		require.Equal(t, "agent", events[0]["source"])
+		require.Equal(t, "node-a", events[0]["host"])
+		require.Equal(t, map[string]any{"message": "msg1", "level": "warn"}, events[0]["event"])
+		require.Equal(t, map[string]any{"k": "v"}, events[0]["fields"])
+		require.NotContains(t, events[1], "fields")
+	})
+
+	t.Run("should wait for indexer acknowledgement", func(t *testing.T) {
+		var ackPolls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "11111111-2222-3333-4444-555555555555", r.Header.Get("X-Splunk-Request-Channel"))
+			switch r.URL.Path {
+			case "/services/collector/event":
+				_, _ = w.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+			case "/services/collector/ack":
+				require.Equal(t, "11111111-2222-3333-4444-555555555555", r.URL.Query().Get("channel"))
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, `{"acks":[7]}`, string(body))
+				if ackPolls.Add(1) < 3 {
+					_, _ = w.Write([]byte(`{"acks":{"7":false}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"acks":{"7":true}}`))
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewSplunkClient(SplunkConfig{
+			URL:             server.URL,
+			Token:           "hec-token",
+			AckChannel:      "11111111-2222-3333-4444-555555555555",
+			AckPollInterval: time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, ackPolls.Load())
+	})
+
+	t.Run("should resend batch when acknowledgement times out", func(t *testing.T) {
+		var sends atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/services/collector/event":
+				sends.Add(1)
+				_, _ = w.Write([]byte(`{"text":"Success","code":0,"ackId":1}`))
+			case "/services/collector/ack":
+				_, _ = w.Write([]byte(`{"acks":{"1":false}}`))
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewSplunkClient(SplunkConfig{
+			URL:             server.URL,
+			Token:           "hec-token",
+			MaxRetries:      1,
+			AckChannel:      "11111111-2222-3333-4444-555555555555",
+			AckTimeout:      20 * time.Millisecond,
+			AckPollInterval: time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.EqualValues(t, 2, sends.Load())
+	})
+
+	t.Run("should not retry on client errors (4xx)", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"text":"Invalid token","code":4}`))
+		}))
+		defer server.Close()
+
+		client, err := NewSplunkClient(SplunkConfig{URL: server.URL, Token: "bad"})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "403")
+		require.Equal(t, 1, attemptCount)
+	})
+}
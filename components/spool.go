@@ -0,0 +1,660 @@
+package components
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpoolSyncPolicy controls when spool writes are fsynced to disk.
+type SpoolSyncPolicy int
+
+const (
+	// SpoolSyncNever leaves flushing to the OS. Batches survive process
+	// restarts but may be lost when the node crashes.
+	SpoolSyncNever SpoolSyncPolicy = iota
+	// SpoolSyncInterval fsyncs at most once per SpoolConfig.SyncInterval.
+	SpoolSyncInterval
+	// SpoolSyncAlways fsyncs after every write.
+	SpoolSyncAlways
+)
+
+const (
+	spoolSegmentExt    = ".seg"
+	spoolCursorFile    = "cursor"
+	spoolHeaderSize    = 8 // Payload length and CRC32, both uint32.
+	spoolMaxRecordSize = 64 << 20
+)
+
+var errSpoolClosed = errors.New("spool is closed")
+
+var DefaultSpoolConfig = SpoolConfig{
+	MaxBytes:     256 << 20,
+	SegmentBytes: 8 << 20,
+	Sync:         SpoolSyncInterval,
+	SyncInterval: time.Second,
+}
+
+type SpoolConfig struct {
+	Dir string
+	// MaxBytes caps the spool size on disk. The oldest segments are dropped
+	// to make room for new batches. Defaults to 256MiB.
+	MaxBytes int64
+	// MaxAge drops segments last written longer ago. Zero keeps them until
+	// MaxBytes is reached.
+	MaxAge time.Duration
+	// SegmentBytes is the size after which a new segment file is started.
+	// Defaults to 8MiB.
+	SegmentBytes int64
+	Sync         SpoolSyncPolicy
+	SyncInterval time.Duration // Used by SpoolSyncInterval, defaults to 1s.
+}
+
+// SpoolStats describes the spool backlog.
+type SpoolStats struct {
+	Segments       int    // Segment files on disk.
+	Bytes          int64  // Bytes not replayed yet.
+	DroppedBytes   uint64 // Bytes dropped because of MaxBytes or MaxAge.
+	CorruptRecords uint64 // Records skipped because they failed to decode.
+}
+
+// Spool is a disk-backed write-ahead queue of entry batches. Batches are
+// appended to segment files as length and CRC32 framed JSON records and
+// replayed in order. The replay position is persisted in a cursor file, so
+// batches survive process restarts. A torn or corrupted record skips the
+// rest of its segment instead of failing the replay.
+type Spool struct {
+	cfg SpoolConfig
+
+	mu       sync.Mutex
+	closed   bool
+	segments []spoolSegment // Ordered oldest first.
+	nextID   uint64
+
+	w        *os.File // Segment being written, always the last one.
+	wSize    int64
+	lastSync time.Time
+
+	cursor spoolCursor
+
+	droppedBytes   uint64
+	corruptRecords uint64
+}
+
+type spoolSegment struct {
+	id      uint64
+	size    int64
+	modTime time.Time
+}
+
+type spoolCursor struct {
+	segment uint64
+	offset  int64
+}
+
+type spoolRecord struct {
+	BatchID string       `json:"batch_id,omitempty"`
+	Entries []spoolEntry `json:"entries"`
+}
+
+// spoolEntry stores Entry.Attributes as spoolValues, so that replayed
+// entries keep their attribute types. Records written before typed
+// attributes were spooled decode through the embedded Entry.
+type spoolEntry struct {
+	Entry
+	TypedAttributes map[string]spoolValue `json:"typed_attributes,omitempty"`
+}
+
+func newSpoolRecord(batchID string, entries []Entry) spoolRecord {
+	record := spoolRecord{BatchID: batchID, Entries: make([]spoolEntry, len(entries))}
+	for i, e := range entries {
+		if e.Attributes != nil {
+			typed := make(map[string]spoolValue, len(e.Attributes))
+			for k, v := range e.Attributes {
+				typed[k] = spoolValue{v}
+			}
+			record.Entries[i].TypedAttributes = typed
+			e.Attributes = nil
+		}
+		record.Entries[i].Entry = e
+	}
+	return record
+}
+
+func (r spoolRecord) entries() []Entry {
+	entries := make([]Entry, len(r.Entries))
+	for i, e := range r.Entries {
+		entries[i] = e.Entry
+		if e.TypedAttributes != nil {
+			attrs := make(map[string]any, len(e.TypedAttributes))
+			for k, v := range e.TypedAttributes {
+				attrs[k] = v.v
+			}
+			entries[i].Attributes = attrs
+		}
+	}
+	return entries
+}
+
+// spoolValue encodes an attribute value as a [kind, value] pair. Integers
+// are stored as strings so that they keep their precision. Values of other
+// types are stored as their JSON encoding and replayed as json.RawMessage.
+type spoolValue struct {
+	v any
+}
+
+func (s spoolValue) MarshalJSON() ([]byte, error) {
+	var kind string
+	var value any
+	switch v := s.v.(type) {
+	case nil:
+		return []byte("null"), nil
+	case string:
+		kind, value = "s", v
+	case bool:
+		kind, value = "b", v
+	case int64:
+		kind, value = "i", strconv.FormatInt(v, 10)
+	case uint64:
+		kind, value = "u", strconv.FormatUint(v, 10)
+	case float64:
+		kind, value = "f", v
+	case time.Time:
+		kind, value = "t", v
+	case map[string]any:
+		m := make(map[string]spoolValue, len(v))
+		for k, item := range v {
+			m[k] = spoolValue{item}
+		}
+		kind, value = "m", m
+	case []any:
+		a := make([]spoolValue, len(v))
+		for i, item := range v {
+			a[i] = spoolValue{item}
+		}
+		kind, value = "a", a
+	case json.RawMessage:
+		kind, value = "r", v
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		kind, value = "r", json.RawMessage(raw)
+	}
+	return json.Marshal([2]any{kind, value})
+}
+
+func (s *spoolValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		s.v = nil
+		return nil
+	}
+	var pair [2]json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	var kind string
+	if err := json.Unmarshal(pair[0], &kind); err != nil {
+		return err
+	}
+	var err error
+	switch kind {
+	case "s":
+		var v string
+		err = json.Unmarshal(pair[1], &v)
+		s.v = v
+	case "b":
+		var v bool
+		err = json.Unmarshal(pair[1], &v)
+		s.v = v
+	case "i", "u":
+		var v string
+		if err = json.Unmarshal(pair[1], &v); err != nil {
+			return err
+		}
+		if kind == "i" {
+			s.v, err = strconv.ParseInt(v, 10, 64)
+		} else {
+			s.v, err = strconv.ParseUint(v, 10, 64)
+		}
+	case "f":
+		var v float64
+		err = json.Unmarshal(pair[1], &v)
+		s.v = v
+	case "t":
+		var v time.Time
+		err = json.Unmarshal(pair[1], &v)
+		s.v = v
+	case "m":
+		var v map[string]spoolValue
+		if err = json.Unmarshal(pair[1], &v); err != nil {
+			return err
+		}
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[k] = item.v
+		}
+		s.v = m
+	case "a":
+		var v []spoolValue
+		if err = json.Unmarshal(pair[1], &v); err != nil {
+			return err
+		}
+		a := make([]any, len(v))
+		for i, item := range v {
+			a[i] = item.v
+		}
+		s.v = a
+	case "r":
+		s.v = pair[1]
+	default:
+		return fmt.Errorf("unknown attribute kind %q", kind)
+	}
+	return err
+}
+
+// OpenSpool opens or creates the spool in cfg.Dir. Segments left by a
+// previous process are kept for replay; new batches always go to a new
+// segment.
+func OpenSpool(cfg SpoolConfig) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("field Dir is required")
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = DefaultSpoolConfig.MaxBytes
+	}
+	if cfg.SegmentBytes == 0 {
+		cfg.SegmentBytes = DefaultSpoolConfig.SegmentBytes
+	}
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = DefaultSpoolConfig.SyncInterval
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating spool dir: %w", err)
+	}
+
+	s := &Spool{cfg: cfg, nextID: 1}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("reading spool dir: %w", err)
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return fmt.Errorf("reading spool segment: %w", err)
+		}
+		s.segments = append(s.segments, spoolSegment{id: id, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+	if n := len(s.segments); n > 0 {
+		s.nextID = s.segments[n-1].id + 1
+	}
+
+	s.cursor = s.readCursor()
+	// Segments before the cursor were fully replayed but not removed yet.
+	for len(s.segments) > 0 && s.segments[0].id < s.cursor.segment {
+		s.removeHead()
+	}
+	if len(s.segments) == 0 || s.segments[0].id != s.cursor.segment {
+		s.cursor = spoolCursor{}
+		if len(s.segments) > 0 {
+			s.cursor.segment = s.segments[0].id
+		}
+	}
+	return nil
+}
+
+// Append writes a batch to the spool, dropping the oldest segments if the
+// spool would grow past MaxBytes.
+func (s *Spool) Append(entries []Entry) error {
+	return s.AppendBatch("", entries)
+}
+
+// AppendBatch is Append keeping the batch ID, which ReplayBatches passes back
+// so that a replayed batch is deduplicated with earlier attempts.
+func (s *Spool) AppendBatch(batchID string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(newSpoolRecord(batchID, entries))
+	if err != nil {
+		return fmt.Errorf("encoding spool record: %w", err)
+	}
+	recordSize := int64(spoolHeaderSize + len(payload))
+	if recordSize > s.cfg.MaxBytes || len(payload) > spoolMaxRecordSize {
+		return fmt.Errorf("batch of %d bytes exceeds spool limits", recordSize)
+	}
+	record := make([]byte, spoolHeaderSize, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSpoolClosed
+	}
+
+	s.expire(time.Now())
+	if s.w != nil && s.wSize > 0 && s.wSize+recordSize > s.cfg.SegmentBytes {
+		if err := s.closeWriter(); err != nil {
+			return err
+		}
+	}
+	for s.size()+recordSize > s.cfg.MaxBytes && len(s.segments) > 0 {
+		if s.w != nil && len(s.segments) == 1 {
+			if err := s.closeWriter(); err != nil {
+				return err
+			}
+		}
+		s.dropHead()
+	}
+	if s.w == nil {
+		if err := s.openWriter(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.w.Write(record); err != nil {
+		return fmt.Errorf("writing spool record: %w", err)
+	}
+	s.wSize += recordSize
+	last := &s.segments[len(s.segments)-1]
+	last.size = s.wSize
+	last.modTime = time.Now()
+	return s.maybeSync()
+}
+
+// Replay passes the spooled batches to fn oldest first. A batch is removed
+// once fn returns nil. Replay stops at the first error from fn and returns
+// it, the failed batch is kept and replayed first next time.
+func (s *Spool) Replay(fn func(entries []Entry) error) error {
+	return s.ReplayBatches(func(_ string, entries []Entry) error {
+		return fn(entries)
+	})
+}
+
+// ReplayBatches is Replay passing the batch ID given to AppendBatch as well.
+func (s *Spool) ReplayBatches(fn func(batchID string, entries []Entry) error) error {
+	for {
+		record, pos, ok, err := s.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(record.BatchID, record.entries()); err != nil {
+			return err
+		}
+		if err := s.commit(pos); err != nil {
+			return err
+		}
+	}
+}
+
+// Empty reports whether there is nothing to replay.
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending() == 0
+}
+
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpoolStats{
+		Segments:       len(s.segments),
+		Bytes:          s.pending(),
+		DroppedBytes:   s.droppedBytes,
+		CorruptRecords: s.corruptRecords,
+	}
+}
+
+// Close syncs and closes the segment being written.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.closeWriter()
+}
+
+// next reads the record at the cursor. It returns the cursor position after
+// the record, to be passed to commit once the batch was delivered.
+func (s *Spool) next() (spoolRecord, spoolCursor, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return spoolRecord{}, spoolCursor{}, false, errSpoolClosed
+	}
+
+	s.expire(time.Now())
+	for len(s.segments) > 0 {
+		head := s.segments[0]
+		if s.cursor.segment != head.id {
+			s.cursor = spoolCursor{segment: head.id}
+		}
+		if s.cursor.offset >= head.size {
+			if s.isWriter(head.id) {
+				return spoolRecord{}, spoolCursor{}, false, nil
+			}
+			s.removeHead()
+			continue
+		}
+
+		record, n, err := s.readRecord(head.id, s.cursor.offset)
+		if err != nil {
+			// Skip what's left of the segment, framing can't be trusted past
+			// a bad record.
+			s.corruptRecords++
+			if s.isWriter(head.id) {
+				s.cursor.offset = head.size
+				return spoolRecord{}, spoolCursor{}, false, nil
+			}
+			s.removeHead()
+			continue
+		}
+		return record, spoolCursor{segment: head.id, offset: s.cursor.offset + n}, true, nil
+	}
+	return spoolRecord{}, spoolCursor{}, false, nil
+}
+
+func (s *Spool) commit(pos spoolCursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The segment may have been dropped while the batch was replayed.
+	if len(s.segments) == 0 || s.segments[0].id != pos.segment || s.cursor.segment != pos.segment {
+		return nil
+	}
+	s.cursor = pos
+	if s.cursor.offset >= s.segments[0].size && !s.isWriter(pos.segment) {
+		s.removeHead()
+		return nil
+	}
+	return s.writeCursor()
+}
+
+func (s *Spool) readRecord(id uint64, offset int64) (spoolRecord, int64, error) {
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return spoolRecord{}, 0, err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return spoolRecord{}, 0, err
+	}
+	r := bufio.NewReader(f)
+
+	var header [spoolHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return spoolRecord{}, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > spoolMaxRecordSize {
+		return spoolRecord{}, 0, fmt.Errorf("record size %d exceeds limit", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return spoolRecord{}, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return spoolRecord{}, 0, errors.New("record checksum mismatch")
+	}
+	var record spoolRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return spoolRecord{}, 0, err
+	}
+	return record, int64(spoolHeaderSize) + int64(size), nil
+}
+
+// expire drops segments last written before MaxAge.
+func (s *Spool) expire(now time.Time) {
+	if s.cfg.MaxAge <= 0 {
+		return
+	}
+	for len(s.segments) > 0 && now.Sub(s.segments[0].modTime) > s.cfg.MaxAge {
+		if s.isWriter(s.segments[0].id) {
+			_ = s.closeWriter()
+		}
+		s.dropHead()
+	}
+}
+
+// dropHead removes the oldest segment before it was fully replayed,
+// counting its pending bytes as dropped.
+func (s *Spool) dropHead() {
+	dropped := s.segments[0].size
+	if s.cursor.segment == s.segments[0].id {
+		dropped -= s.cursor.offset
+	}
+	s.droppedBytes += uint64(max(dropped, 0))
+	s.removeHead()
+}
+
+func (s *Spool) removeHead() {
+	_ = os.Remove(s.segmentPath(s.segments[0].id))
+	s.segments = s.segments[1:]
+	s.cursor = spoolCursor{}
+	if len(s.segments) > 0 {
+		s.cursor.segment = s.segments[0].id
+	}
+	_ = s.writeCursor()
+}
+
+func (s *Spool) openWriter() error {
+	id := s.nextID
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating spool segment: %w", err)
+	}
+	s.nextID++
+	s.w = f
+	s.wSize = 0
+	s.segments = append(s.segments, spoolSegment{id: id, modTime: time.Now()})
+	if len(s.segments) == 1 {
+		s.cursor = spoolCursor{segment: id}
+	}
+	return nil
+}
+
+func (s *Spool) closeWriter() error {
+	if s.w == nil {
+		return nil
+	}
+	syncErr := s.w.Sync()
+	closeErr := s.w.Close()
+	s.w = nil
+	s.wSize = 0
+	return errors.Join(syncErr, closeErr)
+}
+
+func (s *Spool) isWriter(id uint64) bool {
+	return s.w != nil && s.segments[len(s.segments)-1].id == id
+}
+
+func (s *Spool) maybeSync() error {
+	switch s.cfg.Sync {
+	case SpoolSyncAlways:
+	case SpoolSyncInterval:
+		if time.Since(s.lastSync) < s.cfg.SyncInterval {
+			return nil
+		}
+	default:
+		return nil
+	}
+	s.lastSync = time.Now()
+	return s.w.Sync()
+}
+
+func (s *Spool) size() int64 {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total
+}
+
+func (s *Spool) pending() int64 {
+	total := s.size()
+	if len(s.segments) > 0 && s.cursor.segment == s.segments[0].id {
+		total -= s.cursor.offset
+	}
+	return total
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
+
+func (s *Spool) readCursor() spoolCursor {
+	b, err := os.ReadFile(filepath.Join(s.cfg.Dir, spoolCursorFile))
+	if err != nil {
+		return spoolCursor{}
+	}
+	var c spoolCursor
+	if _, err := fmt.Sscanf(string(b), "%d %d", &c.segment, &c.offset); err != nil || c.offset < 0 {
+		return spoolCursor{}
+	}
+	return c
+}
+
+// writeCursor persists the cursor atomically via rename.
+func (s *Spool) writeCursor() error {
+	path := filepath.Join(s.cfg.Dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d\n", s.cursor.segment, s.cursor.offset)
+	if err := os.WriteFile(tmp, []byte(data), 0o640); err != nil {
+		return fmt.Errorf("writing spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing spool cursor: %w", err)
+	}
+	return nil
+}
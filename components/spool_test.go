@@ -0,0 +1,181 @@
+package components_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging/components"
+)
+
+func TestSpool(t *testing.T) {
+	t.Run("should replay batches in order across segments and restarts", func(t *testing.T) {
+		r := require.New(t)
+		dir := t.TempDir()
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: dir, SegmentBytes: 200})
+		r.NoError(err)
+
+		for _, msg := range []string{"m1", "m2", "m3", "m4"} {
+			r.NoError(spool.Append(spoolEntries(msg)))
+		}
+		r.Greater(spool.Stats().Segments, 1)
+
+		var replayed []string
+		err = spool.Replay(func(entries []components.Entry) error {
+			if len(replayed) == 2 {
+				return errors.New("unavailable")
+			}
+			replayed = append(replayed, entries[0].Message)
+			return nil
+		})
+		r.EqualError(err, "unavailable")
+		r.NoError(spool.Close())
+
+		spool, err = components.OpenSpool(components.SpoolConfig{Dir: dir, SegmentBytes: 200})
+		r.NoError(err)
+		r.NoError(spool.Append(spoolEntries("m5")))
+		r.NoError(spool.Replay(func(entries []components.Entry) error {
+			replayed = append(replayed, entries[0].Message)
+			return nil
+		}))
+
+		r.Equal([]string{"m1", "m2", "m3", "m4", "m5"}, replayed)
+		r.True(spool.Empty())
+		r.Zero(spool.Stats().Bytes)
+		r.NoError(spool.Close())
+	})
+
+	t.Run("should drop oldest segments beyond max bytes", func(t *testing.T) {
+		r := require.New(t)
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir(), MaxBytes: 400, SegmentBytes: 100})
+		r.NoError(err)
+		defer spool.Close()
+
+		for i := 0; i < 10; i++ {
+			r.NoError(spool.Append(spoolEntries("msg")))
+		}
+
+		stats := spool.Stats()
+		r.LessOrEqual(stats.Bytes, int64(400))
+		r.NotZero(stats.DroppedBytes)
+		r.Error(spool.Append([]components.Entry{{Message: string(make([]byte, 500))}}))
+	})
+
+	t.Run("should drop segments older than max age", func(t *testing.T) {
+		r := require.New(t)
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir(), MaxAge: 20 * time.Millisecond})
+		r.NoError(err)
+		defer spool.Close()
+
+		r.NoError(spool.Append(spoolEntries("old")))
+		time.Sleep(50 * time.Millisecond)
+		r.NoError(spool.Append(spoolEntries("new")))
+
+		var replayed []string
+		r.NoError(spool.Replay(func(entries []components.Entry) error {
+			replayed = append(replayed, entries[0].Message)
+			return nil
+		}))
+		r.Equal([]string{"new"}, replayed)
+		r.NotZero(spool.Stats().DroppedBytes)
+	})
+
+	t.Run("should skip corrupted segments and keep replaying", func(t *testing.T) {
+		r := require.New(t)
+		dir := t.TempDir()
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: dir, SegmentBytes: 1})
+		r.NoError(err)
+		r.NoError(spool.Append(spoolEntries("m1")))
+		r.NoError(spool.Append(spoolEntries("m2")))
+		r.NoError(spool.Append(spoolEntries("m3")))
+		r.NoError(spool.Close())
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+		r.NoError(err)
+		r.Len(segments, 3)
+		// Flip a payload byte in the first segment and tear the second one.
+		data, err := os.ReadFile(segments[0])
+		r.NoError(err)
+		data[len(data)-2] ^= 0xff
+		r.NoError(os.WriteFile(segments[0], data, 0o600))
+		r.NoError(os.Truncate(segments[1], 5))
+
+		spool, err = components.OpenSpool(components.SpoolConfig{Dir: dir})
+		r.NoError(err)
+		defer spool.Close()
+		var replayed []string
+		r.NoError(spool.Replay(func(entries []components.Entry) error {
+			replayed = append(replayed, entries[0].Message)
+			return nil
+		}))
+
+		r.Equal([]string{"m3"}, replayed)
+		r.EqualValues(2, spool.Stats().CorruptRecords)
+	})
+
+	t.Run("should keep batch IDs", func(t *testing.T) {
+		r := require.New(t)
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir()})
+		r.NoError(err)
+		defer spool.Close()
+
+		r.NoError(spool.AppendBatch("batch-1", spoolEntries("m1")))
+		r.NoError(spool.Append(spoolEntries("m2")))
+
+		var ids []string
+		r.NoError(spool.ReplayBatches(func(batchID string, entries []components.Entry) error {
+			ids = append(ids, batchID)
+			return nil
+		}))
+		r.Equal([]string{"batch-1", ""}, ids)
+	})
+
+	t.Run("should keep attribute types", func(t *testing.T) {
+		r := require.New(t)
+		spool, err := components.OpenSpool(components.SpoolConfig{Dir: t.TempDir()})
+		r.NoError(err)
+		defer spool.Close()
+
+		attrs := map[string]any{
+			"id":      int64(1<<60 + 1),
+			"count":   uint64(1<<64 - 1),
+			"ratio":   0.5,
+			"ok":      true,
+			"at":      time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC),
+			"missing": nil,
+			"req":     map[string]any{"status": int64(200), "path": "/"},
+			"spec":    json.RawMessage(`{"a":[1,2]}`),
+		}
+		entries := spoolEntries("m1")
+		entries[0].Attributes = attrs
+		r.NoError(spool.Append(entries))
+
+		var replayed []components.Entry
+		r.NoError(spool.Replay(func(entries []components.Entry) error {
+			replayed = entries
+			return nil
+		}))
+		r.Len(replayed, 1)
+		r.Equal(attrs, replayed[0].Attributes)
+		r.Equal(map[string]string{"k": "v"}, replayed[0].Fields)
+	})
+
+	t.Run("should require dir", func(t *testing.T) {
+		_, err := components.OpenSpool(components.SpoolConfig{})
+		require.EqualError(t, err, "field Dir is required")
+	})
+}
+
+func spoolEntries(msg string) []components.Entry {
+	return []components.Entry{{
+		Level:   string(components.LogLevelInfo),
+		Message: msg,
+		Time:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Fields:  map[string]string{"k": "v"},
+	}}
+}
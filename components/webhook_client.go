@@ -0,0 +1,186 @@
+package components
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"text/template"
+	"time"
+)
+
+type WebhookConfig struct {
+	URL     string
+	Method  string            // Defaults to POST.
+	Headers map[string]string // Extra headers added to every request.
+
+	// Template renders the request body from a batch. It is executed with a
+	// WebhookPayload, so `{{range .Entries}}{{.Message}}{{end}}` is valid, and
+	// provides `json` (JSON encoding of any value) and `level` (short level
+	// name) functions. An empty template sends one JSON encoded Entry per line.
+	Template    string
+	ContentType string // Defaults to application/json, or application/x-ndjson without a Template.
+
+	BasicAuthUser     string
+	BasicAuthPassword string
+	BearerToken       string // Sent as `Authorization: Bearer <token>`.
+
+	SuccessStatusCodes  []int // Status codes treated as success, defaults to any 2xx.
+	TLSCert             string
+	MaxRetries          int // Number of retries on failure (-1 = no retries)
+	MaxRetryBackoffWait time.Duration
+}
+
+// WebhookPayload is the data a WebhookConfig.Template is executed with.
+type WebhookPayload struct {
+	Entries []Entry
+}
+
+var _ APIClient = (*WebhookClient)(nil)
+
+// WebhookClient posts batches to an arbitrary HTTP endpoint.
+type WebhookClient struct {
+	httpClient *http.Client
+	cfg        WebhookConfig
+	tmpl       *template.Template
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"level": levelName,
+}
+
+func NewWebhookClient(cfg WebhookConfig) (*WebhookClient, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("field URL is required")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+		if cfg.Template == "" {
+			cfg.ContentType = "application/x-ndjson"
+		}
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MaxRetryBackoffWait == 0 {
+		cfg.MaxRetryBackoffWait = 5 * time.Second
+	}
+
+	var tmpl *template.Template
+	if cfg.Template != "" {
+		var err error
+		tmpl, err = template.New("webhook").Funcs(webhookTemplateFuncs).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parsing webhook template: %w", err)
+		}
+	}
+
+	httpClient, err := createHTTPClient(cfg.TLSCert)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+		tmpl:       tmpl,
+	}, nil
+}
+
+func (c *WebhookClient) IngestLogs(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	body, err := c.render(entries)
+	if err != nil {
+		return err
+	}
+
+	maxRetries := max(c.cfg.MaxRetries, 0)
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBackoff(ctx, attempt, c.cfg.MaxRetryBackoffWait); err != nil {
+				return err
+			}
+		}
+
+		err := c.doRequest(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("webhook request failed after %d retries: %w", maxRetries, lastErr)
+}
+
+func (c *WebhookClient) render(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	if c.tmpl != nil {
+		if err := c.tmpl.Execute(&buf, WebhookPayload{Entries: entries}); err != nil {
+			return nil, fmt.Errorf("rendering webhook template: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, fmt.Errorf("encoding webhook entry: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *WebhookClient) doRequest(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, c.cfg.Method, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", c.cfg.ContentType)
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.BasicAuthUser != "":
+		req.SetBasicAuth(c.cfg.BasicAuthUser, c.cfg.BasicAuthPassword)
+	}
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if !c.isSuccess(resp.StatusCode) {
+		respMsg, _ := io.ReadAll(resp.Body)
+		return &httpError{
+			statusCode: resp.StatusCode,
+			message:    fmt.Sprintf("webhook request failed: unexpected status %d: %v", resp.StatusCode, string(respMsg)),
+		}
+	}
+	return nil
+}
+
+func (c *WebhookClient) isSuccess(statusCode int) bool {
+	if len(c.cfg.SuccessStatusCodes) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	return slices.Contains(c.cfg.SuccessStatusCodes, statusCode)
+}
@@ -0,0 +1,138 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_NewWebhookClient(t *testing.T) {
+	t.Run("should require URL", func(t *testing.T) {
+		_, err := NewWebhookClient(WebhookConfig{})
+		require.ErrorContains(t, err, "URL is required")
+	})
+	t.Run("should return err with invalid template", func(t *testing.T) {
+		_, err := NewWebhookClient(WebhookConfig{URL: "http://localhost:1234", Template: "{{.Entries"})
+		require.ErrorContains(t, err, "parsing webhook template")
+	})
+	t.Run("should return err with invalid CA cert", func(t *testing.T) {
+		_, err := NewWebhookClient(WebhookConfig{URL: "http://localhost:1234", TLSCert: "invalid-ca-cert"})
+		require.Error(t, err)
+	})
+}
+
+func TestWebhookClient_IngestLogs(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Level: string(LogLevelError), Message: "disk full", Time: testTime, Fields: map[string]string{"node": "a"}},
+		{Level: string(LogLevelError), Message: `quote "me"`, Time: testTime},
+	}
+
+	t.Run("should send json lines by default", func(t *testing.T) {
+		var receivedRequest *http.Request
+		var receivedBody []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedRequest = r
+			receivedBody, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		client, err := NewWebhookClient(WebhookConfig{
+			URL:         server.URL + "/hook",
+			BearerToken: "token",
+			Headers:     map[string]string{"X-Tenant": "acme"},
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+
+		require.Equal(t, http.MethodPost, receivedRequest.Method)
+		require.Equal(t, "/hook", receivedRequest.URL.Path)
+		require.Equal(t, "Bearer token", receivedRequest.Header.Get("Authorization"))
+		require.Equal(t, "acme", receivedRequest.Header.Get("X-Tenant"))
+		require.Equal(t, "application/x-ndjson", receivedRequest.Header.Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(string(receivedBody)), "\n")
+		require.Len(t, lines, 2)
+		var got Entry
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+		require.Equal(t, entries[0], got)
+	})
+
+	t.Run("should render body from template", func(t *testing.T) {
+		var receivedRequest *http.Request
+		var receivedBody []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedRequest = r
+			receivedBody, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		client, err := NewWebhookClient(WebhookConfig{
+			URL:               server.URL,
+			Method:            http.MethodPut,
+			Template:          `{"text": {{range $i, $e := .Entries}}{{if $i}} + {{end}}{{json (printf "[%s] %s" (level $e.Level) $e.Message)}}{{end}}}`,
+			BasicAuthUser:     "user",
+			BasicAuthPassword: "pass",
+		})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries[1:])
+		require.NoError(t, err)
+
+		require.Equal(t, http.MethodPut, receivedRequest.Method)
+		require.Equal(t, "application/json", receivedRequest.Header.Get("Content-Type"))
+		user, pass, ok := receivedRequest.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", user)
+		require.Equal(t, "pass", pass)
+		require.JSONEq(t, `{"text": "[error] quote \"me\""}`, string(receivedBody))
+	})
+
+	t.Run("should only accept configured success status codes", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		client, err := NewWebhookClient(WebhookConfig{URL: server.URL, SuccessStatusCodes: []int{http.StatusOK}})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "202")
+		require.Equal(t, 1, attemptCount, "should not retry on non-5xx statuses")
+	})
+
+	t.Run("should retry on server errors (5xx)", func(t *testing.T) {
+		attemptCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attemptCount++
+			if attemptCount < 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client, err := NewWebhookClient(WebhookConfig{URL: server.URL})
+		require.NoError(t, err)
+
+		err = client.IngestLogs(context.Background(), entries)
+		require.NoError(t, err)
+		require.Equal(t, 2, attemptCount)
+	})
+}
@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var DefaultConsoleHandlerConfig = ConsoleHandlerConfig{
+	Level:  MustParseLevel("INFO"),
+	Output: os.Stdout,
+}
+
+type ConsoleHandlerConfig struct {
+	Level     slog.Level
+	Output    io.Writer
+	AddSource bool
+	// NoColor disables ANSI colors, e.g. when the output is not a terminal.
+	NoColor bool
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+)
+
+// NewConsoleHandler returns a handler writing compact, colored lines meant
+// for humans reading a terminal during local development:
+//
+//	15:04:05.000 INF request handled status=200 http.path=/api
+//
+// Use the text or JSON handlers for logs collected by machines.
+func NewConsoleHandler(cfg ConsoleHandlerConfig) Handler {
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	return HandlerFunc(func(_ slog.Handler) slog.Handler {
+		return &consoleHandler{cfg: cfg, mu: &sync.Mutex{}}
+	})
+}
+
+type consoleHandler struct {
+	cfg ConsoleHandlerConfig
+	mu  *sync.Mutex // Shared by clones writing to the same output.
+
+	attrs  []byte // Attributes added by WithAttrs, already formatted.
+	prefix string // Open groups joined with dots, with a trailing dot.
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.cfg.Level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := make([]byte, 0, 256)
+	if !r.Time.IsZero() {
+		buf = h.appendColored(buf, ansiDim, r.Time.Format(time.TimeOnly+".000"))
+		buf = append(buf, ' ')
+	}
+	buf = h.appendLevel(buf, r.Level)
+	buf = append(buf, ' ')
+	buf = append(buf, r.Message...)
+	buf = append(buf, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.prefix, a)
+		return true
+	})
+	if h.cfg.AddSource && r.PC != 0 {
+		if src := r.Source(); src != nil {
+			buf = append(buf, ' ')
+			buf = h.appendColored(buf, ansiDim, filepath.Base(src.File)+":"+strconv.Itoa(src.Line))
+		}
+	}
+	buf = append(buf, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.cfg.Output.Write(buf)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		clone.attrs = h.appendAttr(clone.attrs, h.prefix, a)
+	}
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func (h *consoleHandler) appendLevel(buf []byte, level slog.Level) []byte {
+	var color, name string
+	switch {
+	case level >= slog.LevelError:
+		color, name = ansiRed, "ERR"
+	case level >= slog.LevelWarn:
+		color, name = ansiYellow, "WRN"
+	case level >= slog.LevelInfo:
+		color, name = ansiGreen, "INF"
+	default:
+		color, name = ansiBlue, "DBG"
+	}
+	return h.appendColored(buf, color, name)
+}
+
+func (h *consoleHandler) appendAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			buf = h.appendAttr(buf, prefix, ga)
+		}
+		return buf
+	}
+
+	buf = append(buf, ' ')
+	buf = h.appendColored(buf, ansiDim, prefix+a.Key+"=")
+	var value string
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		value = a.Value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			value = err.Error()
+		} else {
+			value = a.Value.String()
+		}
+	default:
+		value = a.Value.String()
+	}
+	if needsQuoting(value) {
+		value = strconv.Quote(value)
+	}
+	return append(buf, value...)
+}
+
+func (h *consoleHandler) appendColored(buf []byte, color, s string) []byte {
+	if h.cfg.NoColor {
+		return append(buf, s...)
+	}
+	buf = append(buf, color...)
+	buf = append(buf, s...)
+	return append(buf, ansiReset...)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	return strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	})
+}
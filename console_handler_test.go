@@ -0,0 +1,65 @@
+package logging_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	t.Run("should format records", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		log := logging.New(logging.NewConsoleHandler(logging.ConsoleHandlerConfig{
+			Level:   slog.LevelDebug,
+			Output:  &buf,
+			NoColor: true,
+		}))
+
+		log.WithField("component", "api").Log.WithGroup("http").Info("request handled",
+			"path", "/v1/logs",
+			"status", 200,
+			slog.Group("client", "ip", "10.0.0.1"),
+			"err", errors.New("bad input"),
+			"empty", "",
+		)
+		log.Debug("debug")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		r.Len(lines, 2)
+		r.Regexp(`^\d\d:\d\d:\d\d\.\d{3} INF request handled component=api http.path=/v1/logs http.status=200 http.client.ip=10.0.0.1 http.err="bad input" http.empty=""$`, lines[0])
+		r.Regexp(` DBG debug$`, lines[1])
+	})
+
+	t.Run("should filter by level", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := logging.New(logging.NewConsoleHandler(logging.ConsoleHandlerConfig{
+			Level:   slog.LevelWarn,
+			Output:  &buf,
+			NoColor: true,
+		}))
+		log.Info("hidden")
+		log.Error("shown")
+		require.NotContains(t, buf.String(), "hidden")
+		require.Contains(t, buf.String(), "ERR shown")
+	})
+
+	t.Run("should color levels and add source", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		log := logging.New(logging.NewConsoleHandler(logging.ConsoleHandlerConfig{
+			Level:     slog.LevelInfo,
+			Output:    &buf,
+			AddSource: true,
+		}))
+		log.Warn("careful")
+		r.Contains(buf.String(), "\x1b[33mWRN\x1b[0m careful")
+		r.Contains(buf.String(), "console_handler_test.go:")
+	})
+}
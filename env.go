@@ -2,44 +2,203 @@ package logging
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
-// Env var names read by New.
+// Env var names read by New and NewFromEnv.
 const (
 	EnvJSONLog     = "JSON_LOG"
 	EnvLogTimeZone = "LOG_TIMEZONE"
+
+	EnvLogLevel     = "LOG_LEVEL"      // debug, info, warn, error. Defaults to info.
+	EnvLogFormat    = "LOG_FORMAT"     // text, json or console. Defaults to JSON_LOG.
+	EnvLogAddSource = "LOG_ADD_SOURCE" // Bool.
+	EnvLogOutput    = "LOG_OUTPUT"     // stdout, stderr or a file path. Defaults to stdout.
+	EnvLogRateLimit = "LOG_RATE_LIMIT" // Records per second and level, unlimited if unset.
+	EnvLogRateBurst = "LOG_RATE_BURST" // Defaults to DefaultRateLimitHandlerConfig.Burst.
+	EnvLogCommit    = "LOG_COMMIT"     // Bool, or a revision overriding the build info.
 )
 
-// envJSONLog returns true when JSON_LOG parses as a truthy bool. Panics on
-// invalid values (matches the MustParseLevel convention).
-func envJSONLog() bool {
-	v := os.Getenv(EnvJSONLog)
+// NewFromEnv returns a Logger whose handler chain is assembled from the
+// LOG_* env variables above, plus JSON_LOG and LOG_TIMEZONE as read by New.
+// Unlike New, invalid values are returned as errors naming the variable.
+//
+// handlers, e.g. an ExportHandler, are registered on top of the base format
+// handler, so the commit field, time zone and rate limit apply to them too.
+// A file given in LOG_OUTPUT is opened for appending and stays open for the
+// lifetime of the process.
+func NewFromEnv(handlers ...Handler) (*Logger, error) {
+	level := slog.LevelInfo
+	if v := os.Getenv(EnvLogLevel); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("logging: parsing %s=%q: %w", EnvLogLevel, v, err)
+		}
+	}
+	addSource, err := parseEnvBool(EnvLogAddSource)
+	if err != nil {
+		return nil, err
+	}
+	isJSONSet, err := parseEnvBool(EnvJSONLog)
+	if err != nil {
+		return nil, err
+	}
+	tz, err := parseEnvTimeZone()
+	if err != nil {
+		return nil, err
+	}
+	format := os.Getenv(EnvLogFormat)
+	switch format {
+	case "", "text", "json", "console":
+	default:
+		return nil, fmt.Errorf("logging: parsing %s=%q: expected text, json or console", EnvLogFormat, format)
+	}
+	rateCfg, rateLimited, err := envRateLimit()
+	if err != nil {
+		return nil, err
+	}
+	// Opened once everything else is valid, so no error leaks the file.
+	out, isFile, err := envOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	var base Handler
+	switch format {
+	case "":
+		if isJSONSet {
+			base = NewJSONHandler(JSONHandlerConfig{Level: level, Output: out, AddSource: addSource})
+		} else {
+			base = NewTextHandler(TextHandlerConfig{Level: level, Output: out, AddSource: addSource})
+		}
+	case "text":
+		base = NewTextHandler(TextHandlerConfig{Level: level, Output: out, AddSource: addSource})
+	case "json":
+		base = NewJSONHandler(JSONHandlerConfig{Level: level, Output: out, AddSource: addSource})
+	case "console":
+		base = NewConsoleHandler(ConsoleHandlerConfig{
+			Level:     level,
+			Output:    out,
+			AddSource: addSource,
+			NoColor:   isFile || os.Getenv("NO_COLOR") != "",
+		})
+	}
+
+	registered := append([]Handler{base}, handlers...)
+	if commit := os.Getenv(EnvLogCommit); commit != "" {
+		if enabled, err := strconv.ParseBool(commit); err != nil {
+			registered = append(registered, NewCommitHandler(commit))
+		} else if enabled {
+			registered = append(registered, NewCommitHandler())
+		}
+	}
+	if tz != nil {
+		registered = append(registered, NewTimeZoneHandler(tz))
+	}
+	if rateLimited {
+		registered = append(registered, NewRateLimitHandler(rateCfg))
+	}
+
+	return &Logger{Log: slog.New(chain(registered))}, nil
+}
+
+// envOutput returns the writer named by LOG_OUTPUT and whether it's a file.
+func envOutput() (io.Writer, bool, error) {
+	v := os.Getenv(EnvLogOutput)
+	out, isFile, err := openOutput(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("logging: opening %s=%q: %w", EnvLogOutput, v, err)
+	}
+	return out, isFile, nil
+}
+
+// openOutput returns stdout for "" or "stdout", stderr for "stderr", or
+// else the named file opened for appending, and whether it's a file.
+func openOutput(v string) (io.Writer, bool, error) {
+	switch v {
+	case "", "stdout":
+		return os.Stdout, false, nil
+	case "stderr":
+		return os.Stderr, false, nil
+	default:
+		f, err := os.OpenFile(v, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) // #nosec G302 G304
+		if err != nil {
+			return nil, false, err
+		}
+		return f, true, nil
+	}
+}
+
+// envRateLimit returns the rate limit config from LOG_RATE_LIMIT and
+// LOG_RATE_BURST, reporting false when no limit is set.
+func envRateLimit() (RateLimiterHandlerConfig, bool, error) {
+	v := os.Getenv(EnvLogRateLimit)
 	if v == "" {
-		return false
+		return RateLimiterHandlerConfig{}, false, nil
 	}
+	limit, err := strconv.ParseFloat(v, 64)
+	if err != nil || limit <= 0 {
+		return RateLimiterHandlerConfig{}, false, fmt.Errorf("logging: parsing %s=%q: expected a positive number", EnvLogRateLimit, v)
+	}
+	cfg := RateLimiterHandlerConfig{Limit: rate.Limit(limit), Burst: DefaultRateLimitHandlerConfig.Burst}
+	if v := os.Getenv(EnvLogRateBurst); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil || burst <= 0 {
+			return RateLimiterHandlerConfig{}, false, fmt.Errorf("logging: parsing %s=%q: expected a positive integer", EnvLogRateBurst, v)
+		}
+		cfg.Burst = burst
+	}
+	return cfg, true, nil
+}
 
+func parseEnvBool(name string) (bool, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return false, nil
+	}
 	b, err := strconv.ParseBool(v)
 	if err != nil {
-		panic(fmt.Errorf("logging: parsing %s=%q as bool: %w", EnvJSONLog, v, err))
+		return false, fmt.Errorf("logging: parsing %s=%q as bool: %w", name, v, err)
 	}
-
-	return b
+	return b, nil
 }
 
-// envTimeZone returns the location named by LOG_TIMEZONE, or nil if unset.
-// Panics if the zone cannot be loaded.
-func envTimeZone() *time.Location {
+// parseEnvTimeZone returns the location named by LOG_TIMEZONE, or nil if
+// unset.
+func parseEnvTimeZone() (*time.Location, error) {
 	v := os.Getenv(EnvLogTimeZone)
 	if v == "" {
-		return nil
+		return nil, nil
 	}
 	loc, err := time.LoadLocation(v)
 	if err != nil {
-		panic(fmt.Errorf("logging: loading %s=%q: %w", EnvLogTimeZone, v, err))
+		return nil, fmt.Errorf("logging: loading %s=%q: %w", EnvLogTimeZone, v, err)
 	}
+	return loc, nil
+}
+
+// envJSONLog returns true when JSON_LOG parses as a truthy bool. Panics on
+// invalid values (matches the MustParseLevel convention).
+func envJSONLog() bool {
+	b, err := parseEnvBool(EnvJSONLog)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
 
+// envTimeZone returns the location named by LOG_TIMEZONE, or nil if unset.
+// Panics if the zone cannot be loaded.
+func envTimeZone() *time.Location {
+	loc, err := parseEnvTimeZone()
+	if err != nil {
+		panic(err)
+	}
 	return loc
 }
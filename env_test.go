@@ -0,0 +1,128 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	readLines := func(t *testing.T, path string) []string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	t.Run("should build the handler chain from env", func(t *testing.T) {
+		r := require.New(t)
+		out := filepath.Join(t.TempDir(), "app.log")
+		t.Setenv(logging.EnvLogLevel, "debug")
+		t.Setenv(logging.EnvLogFormat, "json")
+		t.Setenv(logging.EnvLogAddSource, "true")
+		t.Setenv(logging.EnvLogOutput, out)
+		t.Setenv(logging.EnvLogCommit, "0123456789abcdef")
+		t.Setenv(logging.EnvLogTimeZone, "UTC")
+
+		log, err := logging.NewFromEnv()
+		r.NoError(err)
+		log.Debug("debug message")
+
+		lines := readLines(t, out)
+		r.Len(lines, 1)
+		var rec map[string]any
+		r.NoError(json.Unmarshal([]byte(lines[0]), &rec))
+		r.Equal("debug message", rec["msg"])
+		r.Equal("DEBUG", rec["level"])
+		r.Equal("01234567", rec["commit"])
+		r.Contains(rec, "source")
+	})
+
+	t.Run("should rate limit records", func(t *testing.T) {
+		r := require.New(t)
+		out := filepath.Join(t.TempDir(), "app.log")
+		t.Setenv(logging.EnvLogOutput, out)
+		t.Setenv(logging.EnvLogRateLimit, "0.001")
+		t.Setenv(logging.EnvLogRateBurst, "2")
+
+		log, err := logging.NewFromEnv()
+		r.NoError(err)
+		for range 5 {
+			log.Info("message")
+		}
+		r.Len(readLines(t, out), 2)
+	})
+
+	t.Run("should write console format without colors to files", func(t *testing.T) {
+		r := require.New(t)
+		out := filepath.Join(t.TempDir(), "app.log")
+		t.Setenv(logging.EnvLogFormat, "console")
+		t.Setenv(logging.EnvLogOutput, out)
+
+		log, err := logging.NewFromEnv()
+		r.NoError(err)
+		log.WithField("k", "v").Warn("careful")
+
+		lines := readLines(t, out)
+		r.Len(lines, 1)
+		r.Regexp(`^\d\d:\d\d:\d\d\.\d{3} WRN careful k=v$`, lines[0])
+	})
+
+	t.Run("should fall back to JSON_LOG and register extra handlers", func(t *testing.T) {
+		r := require.New(t)
+		out := filepath.Join(t.TempDir(), "app.log")
+		t.Setenv(logging.EnvJSONLog, "true")
+		t.Setenv(logging.EnvLogOutput, out)
+		t.Setenv(logging.EnvLogCommit, "false")
+
+		log, err := logging.NewFromEnv(logging.NewCommitHandler("fedcba9876543210"))
+		r.NoError(err)
+		log.Info("message")
+
+		var rec map[string]any
+		r.NoError(json.Unmarshal([]byte(readLines(t, out)[0]), &rec))
+		r.Equal("fedcba98", rec["commit"])
+	})
+
+	t.Run("should not open LOG_OUTPUT when other variables are invalid", func(t *testing.T) {
+		for key, value := range map[string]string{logging.EnvLogFormat: "xml", logging.EnvLogRateLimit: "-1"} {
+			t.Run(key, func(t *testing.T) {
+				out := filepath.Join(t.TempDir(), "app.log")
+				t.Setenv(logging.EnvLogOutput, out)
+				t.Setenv(key, value)
+				_, err := logging.NewFromEnv()
+				require.Error(t, err)
+				require.NoFileExists(t, out)
+			})
+		}
+	})
+
+	t.Run("should return errors naming the variable", func(t *testing.T) {
+		tests := []struct {
+			key    string
+			value  string
+			errMsg string
+		}{
+			{logging.EnvLogLevel, "loud", `logging: parsing LOG_LEVEL="loud"`},
+			{logging.EnvLogFormat, "xml", `logging: parsing LOG_FORMAT="xml": expected text, json or console`},
+			{logging.EnvLogAddSource, "maybe", `logging: parsing LOG_ADD_SOURCE="maybe" as bool`},
+			{logging.EnvJSONLog, "maybe", `logging: parsing JSON_LOG="maybe" as bool`},
+			{logging.EnvLogTimeZone, "Mars/Base", `logging: loading LOG_TIMEZONE="Mars/Base"`},
+			{logging.EnvLogRateLimit, "-1", `logging: parsing LOG_RATE_LIMIT="-1": expected a positive number`},
+			{logging.EnvLogOutput, "/nonexistent/dir/app.log", `logging: opening LOG_OUTPUT="/nonexistent/dir/app.log"`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.key, func(t *testing.T) {
+				t.Setenv(tt.key, tt.value)
+				_, err := logging.NewFromEnv()
+				require.ErrorContains(t, err, tt.errMsg)
+			})
+		}
+	})
+}
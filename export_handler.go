@@ -2,25 +2,70 @@ package logging
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"os"
+	"runtime"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/castai/logging/components"
 )
 
 var _ Handler = new(ExportHandler)
 
+// defaultExportTimeout bounds exports when ExportHandlerConfig.Timeout is
+// zero.
+const defaultExportTimeout = 200 * time.Millisecond
+
 var DefaultExportHandlerConfig = ExportHandlerConfig{
 	MinLevel: slog.LevelInfo,
+	Timeout:  defaultExportTimeout,
 }
 
 type ExportHandlerConfig struct {
 	MinLevel slog.Level // Only export logs for this min log level.
+	// Level, when set, takes precedence over MinLevel. Pass a *slog.LevelVar
+	// to change the export level at runtime. The export level is independent
+	// of the level of the next handlers: records below it are still passed
+	// on, and records the next handlers don't accept are still exported.
+	Level slog.Leveler
+	// Name is the logger name sent with every entry. Group names are
+	// appended to it, separated by dots.
+	Name string
+	// Timeout is the most time a log call may spend exporting a record,
+	// 200ms when zero. A shorter deadline on the caller's context is always
+	// honored, a negative Timeout leaves only that one. The caller's
+	// cancellation is never honored, so records logged while a request is
+	// being cancelled are still exported.
+	Timeout time.Duration
+	// OnError is called with export failures. They are not returned from
+	// Handle, slog discards them. Defaults to printing to stderr.
+	OnError func(err error)
+	// Redactor, when set, masks secrets and PII in exported records only;
+	// the records passed on to the next handler are left untouched.
+	Redactor *Redactor
+	// SchemaVersion decides whether typed Entry.Attributes are built, which
+	// only components.SchemaVersionV2 sends. Defaults to the version the
+	// client reports through components.SchemaVersioner, or
+	// components.SchemaVersionV1.
+	SchemaVersion string
 }
 
 func NewExportHandler(apiClient components.APIClient, cfg ExportHandlerConfig) *ExportHandler {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultExportTimeout
+	}
+	if cfg.SchemaVersion == "" {
+		cfg.SchemaVersion = components.SchemaVersionV1
+		if v, ok := apiClient.(components.SchemaVersioner); ok {
+			cfg.SchemaVersion = v.SchemaVersion()
+		}
+	}
 	handler := &ExportHandler{
 		apiClient: apiClient,
 		cfg:       cfg,
@@ -46,54 +91,174 @@ func (h *ExportHandler) Register(next slog.Handler) slog.Handler {
 }
 
 func (h *ExportHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	if h.next == nil {
+	if h.next == nil || h.exportEnabled(level) {
 		return true
 	}
 	return h.next.Enabled(ctx, level)
 }
 
 func (h *ExportHandler) Handle(ctx context.Context, record slog.Record) error {
-	var err error
-	if record.Level >= h.cfg.MinLevel {
-		err = h.ingestLogs(&record)
+	if !h.exportEnabled(record.Level) {
+		// Enabled passed because the next handler accepts the record. It
+		// isn't asked again: stateful handlers such as RateLimitHandler
+		// would be charged twice.
+		if h.next == nil {
+			return nil
+		}
+		return h.next.Handle(ctx, record)
 	}
-	if h.next == nil {
-		return err
+	if err := h.ingestLogs(ctx, &record); err != nil {
+		h.reportError(err)
 	}
-	if handleErr := h.next.Handle(ctx, record); handleErr != nil {
-		err = errors.Join(err, handleErr)
+	// Enabled didn't ask the next handler for records at the export level.
+	if h.next == nil || !h.next.Enabled(ctx, record.Level) {
+		return nil
 	}
-	return err
+	return h.next.Handle(ctx, record)
 }
 
-func (h *ExportHandler) ingestLogs(record *slog.Record) error {
+func (h *ExportHandler) reportError(err error) {
+	if h.cfg.OnError != nil {
+		h.cfg.OnError(err)
+		return
+	}
+	// Not through the log package: it may be routed back to this handler.
+	_, _ = fmt.Fprintf(os.Stderr, "failed to export log: %v\n", err)
+}
+
+// exportContext returns the context for one export call: ctx's values
+// without its cancellation, with the earlier of ctx's deadline and the
+// timeout.
+func (h *ExportHandler) exportContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	deadline, ok := ctx.Deadline()
+	if h.cfg.Timeout > 0 {
+		if timeout := time.Now().Add(h.cfg.Timeout); !ok || timeout.Before(deadline) {
+			deadline, ok = timeout, true
+		}
+	}
+	if !ok {
+		return context.WithoutCancel(ctx), func() {}
+	}
+	return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+}
+
+func (h *ExportHandler) exportEnabled(level slog.Level) bool {
+	if h.cfg.Level != nil {
+		return level >= h.cfg.Level.Level()
+	}
+	return level >= h.cfg.MinLevel
+}
+
+func (h *ExportHandler) ingestLogs(ctx context.Context, record *slog.Record) error {
 	if len(record.Message) == 0 {
 		return nil
 	}
+	if h.cfg.Redactor != nil {
+		redacted := h.cfg.Redactor.RedactRecord(*record)
+		record = &redacted
+	}
 	fieldsM := make(map[string]string)
+	entry := components.Entry{
+		Level:     mapSlogLevel(record.Level),
+		Message:   record.Message,
+		Time:      record.Time,
+		Fields:    fieldsM,
+		Source:    recordSource(record),
+		Logger:    h.loggerName(),
+		Sequence:  components.NextSequence(),
+		ProcessID: components.ProcessID(),
+	}
+	// Typed attributes are only sent with the v2 schema.
+	var typed map[string]any
+	if h.cfg.SchemaVersion == components.SchemaVersionV2 {
+		entry.Attributes = make(map[string]any)
+		typed = groupMap(entry.Attributes, h.groups)
+	}
 
-	for _, attr := range h.attrs {
+	// The v1 endpoint only reads fields, and grouped attrs are not trace
+	// context.
+	moveTrace := h.cfg.SchemaVersion == components.SchemaVersionV2 && len(h.groups) == 0
+	addAttr := func(attr slog.Attr) {
+		if moveTrace && setTraceAttr(&entry, attr) {
+			return
+		}
 		addAttrToMap(fieldsM, attr, h.groups)
+		if typed != nil {
+			addTypedAttr(typed, attr)
+		}
+	}
+	for _, attr := range h.attrs {
+		addAttr(attr)
 	}
-
 	record.Attrs(func(attr slog.Attr) bool {
-		addAttrToMap(fieldsM, attr, h.groups)
+		addAttr(attr)
 		return true
 	})
 
-	return h.apiClient.IngestLogs(context.Background(), []components.Entry{{
-		Level:   mapSlogLevel(record.Level),
-		Message: record.Message,
-		Time:    record.Time,
-		Fields:  fieldsM,
-	}})
+	if e := getTraceExtractor(); e != nil && ctx != nil {
+		if entry.TraceID == "" {
+			entry.TraceID = e.TraceID(ctx)
+		}
+		if entry.SpanID == "" {
+			entry.SpanID = e.SpanID(ctx)
+		}
+	}
+
+	exportCtx, cancel := h.exportContext(ctx)
+	defer cancel()
+	return h.apiClient.IngestLogs(exportCtx, []components.Entry{entry})
+}
+
+func (h *ExportHandler) loggerName() string {
+	if h.cfg.Name == "" {
+		return strings.Join(h.groups, ".")
+	}
+	return strings.Join(append([]string{h.cfg.Name}, h.groups...), ".")
+}
+
+// recordSource returns the caller location recorded in the record's PC.
+func recordSource(record *slog.Record) *components.Source {
+	if record.PC == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames([]uintptr{record.PC})
+	frame, _ := frames.Next()
+	if frame.File == "" && frame.Function == "" {
+		return nil
+	}
+	return &components.Source{
+		Function: frame.Function,
+		File:     frame.File,
+		Line:     frame.Line,
+	}
+}
+
+// setTraceAttr moves top-level trace_id and span_id attributes into the
+// entry's trace context instead of its fields, for the v2 schema. It
+// reports whether attr was consumed.
+func setTraceAttr(entry *components.Entry, attr slog.Attr) bool {
+	if attr.Value.Kind() != slog.KindString {
+		return false
+	}
+	switch attr.Key {
+	case traceIDKey:
+		entry.TraceID = attr.Value.String()
+	case spanIDKey:
+		entry.SpanID = attr.Value.String()
+	default:
+		return false
+	}
+	return true
 }
 
 func (h *ExportHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	clone := &ExportHandler{
 		cfg:       h.cfg,
 		apiClient: h.apiClient,
-		attrs:     slices.Clone(slices.Concat(h.attrs, attrs)),
+		attrs:     slices.Concat(h.attrs, h.redactAttrs(attrs)),
 		groups:    slices.Clone(h.groups),
 	}
 	if h.next != nil {
@@ -115,6 +280,13 @@ func (h *ExportHandler) WithGroup(name string) slog.Handler {
 	return clone
 }
 
+func (h *ExportHandler) redactAttrs(attrs []slog.Attr) []slog.Attr {
+	if h.cfg.Redactor == nil {
+		return attrs
+	}
+	return h.cfg.Redactor.redactAttrs(attrs)
+}
+
 func addAttrToMap(m map[string]string, attr slog.Attr, groups []string) {
 	key := attr.Key
 	if len(groups) > 0 {
@@ -126,7 +298,7 @@ func addAttrToMap(m map[string]string, attr slog.Attr, groups []string) {
 	}
 
 	// Handle different value types
-	val := attr.Value
+	val := attr.Value.Resolve()
 	switch val.Kind() {
 	case slog.KindString:
 		m[key] = val.String()
@@ -135,7 +307,7 @@ func addAttrToMap(m map[string]string, attr slog.Attr, groups []string) {
 	case slog.KindUint64:
 		m[key] = fmt.Sprintf("%d", val.Uint64())
 	case slog.KindFloat64:
-		m[key] = fmt.Sprintf("%f", val.Float64())
+		m[key] = strconv.FormatFloat(val.Float64(), 'f', -1, 64)
 	case slog.KindBool:
 		m[key] = fmt.Sprintf("%t", val.Bool())
 	case slog.KindTime:
@@ -159,6 +331,116 @@ func addAttrToMap(m map[string]string, attr slog.Attr, groups []string) {
 	}
 }
 
+// groupMap returns the nested map for the group path, creating it in m.
+func groupMap(m map[string]any, groups []string) map[string]any {
+	for _, g := range groups {
+		sub, ok := m[g].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			m[g] = sub
+		}
+		m = sub
+	}
+	return m
+}
+
+// addTypedAttr adds attr to m keeping the value type: numbers, bools and
+// times stay as such, groups become nested maps and other values are
+// encoded to JSON.
+func addTypedAttr(m map[string]any, attr slog.Attr) {
+	val := attr.Value.Resolve()
+	if val.Kind() == slog.KindGroup {
+		group := val.Group()
+		if len(group) == 0 {
+			return
+		}
+		// Groups with an empty key are inlined, as in slog handlers.
+		if attr.Key != "" {
+			m = groupMap(m, []string{attr.Key})
+		}
+		for _, groupAttr := range group {
+			addTypedAttr(m, groupAttr)
+		}
+		return
+	}
+	m[attr.Key] = typedValue(val)
+}
+
+func typedValue(val slog.Value) any {
+	switch val.Kind() {
+	case slog.KindString:
+		return val.String()
+	case slog.KindInt64:
+		return val.Int64()
+	case slog.KindUint64:
+		return val.Uint64()
+	case slog.KindFloat64:
+		return floatValue(val.Float64())
+	case slog.KindBool:
+		return val.Bool()
+	case slog.KindTime:
+		return val.Time()
+	case slog.KindDuration:
+		return val.Duration().String()
+	default:
+		return anyValue(val.Any())
+	}
+}
+
+// anyValue converts v without encoding it when it is a basic type. Other
+// values, such as structs and maps, are encoded to JSON once, which also
+// snapshots them before they are exported asynchronously. Values that can't
+// be encoded fall back to their formatted string.
+func anyValue(v any) any {
+	switch v := v.(type) {
+	case nil, string, bool, int64, uint64, time.Time:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case float32:
+		return floatValue(float64(v))
+	case float64:
+		return floatValue(v)
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		if _, ok := v.(json.Marshaler); !ok {
+			return v.String()
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return json.RawMessage(b)
+}
+
+// floatValue returns f, or its string form for values JSON can't represent:
+// NaN and infinities.
+func floatValue(f float64) any {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return f
+}
+
 func mapSlogLevel(level slog.Level) string {
 	switch {
 	case level >= slog.LevelError:
@@ -1,10 +1,18 @@
 package logging_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"github.com/stretchr/testify/require"
+	"io"
 	"log/slog"
+	"math"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
 
 	"github.com/castai/logging"
 	"github.com/castai/logging/components"
@@ -69,6 +77,312 @@ func TestExportHandler(t *testing.T) {
 	r.NotEmpty(log6.Time)
 }
 
+func TestExportHandler_TypedAttributes(t *testing.T) {
+	r := require.New(t)
+	client := &apiClient{}
+	cfg := logging.DefaultExportHandlerConfig
+	cfg.SchemaVersion = components.SchemaVersionV2
+	log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: io.Discard}),
+		logging.NewExportHandler(client, cfg))
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	log.With(slog.Int("count", 3)).With(
+		slog.Float64("ratio", 0.123456789),
+		slog.Bool("ok", true),
+		slog.Time("at", ts),
+		slog.Any("owner", emailValuer("alice@example.com")),
+		slog.Any("spec", struct {
+			Name     string `json:"name"`
+			Replicas int    `json:"replicas"`
+		}{Name: "web", Replicas: 2}),
+		slog.Group("http", slog.Int("status", 200)),
+		slog.Float64("nan", math.NaN()),
+	).Info("msg")
+
+	r.Len(client.logs, 1)
+	entry := client.logs[0]
+	r.Equal(map[string]any{
+		"count": int64(3),
+		"ratio": 0.123456789,
+		"ok":    true,
+		"at":    ts,
+		"owner": "alice@example.com",
+		"spec":  json.RawMessage(`{"name":"web","replicas":2}`),
+		"http":  map[string]any{"status": int64(200)},
+		"nan":   "NaN",
+	}, entry.Attributes)
+	r.Equal("0.123456789", entry.Fields["ratio"], "floats keep their precision")
+	r.Equal("alice@example.com", entry.Fields["owner"], "LogValuer values are resolved")
+	r.Equal("200", entry.Fields["http.status"])
+}
+
+func TestExportHandler_SchemaVersion(t *testing.T) {
+	t.Run("should not build typed attributes for the v1 schema", func(t *testing.T) {
+		r := require.New(t)
+		client := &apiClient{}
+		log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: io.Discard}),
+			logging.NewExportHandler(client, logging.DefaultExportHandlerConfig))
+
+		log.Log.Info("msg", "count", 3)
+
+		r.Len(client.logs, 1)
+		r.Nil(client.logs[0].Attributes)
+		r.Equal(map[string]string{"count": "3"}, client.logs[0].Fields)
+	})
+
+	t.Run("should use the schema version reported by the client", func(t *testing.T) {
+		r := require.New(t)
+		client := &versionedClient{version: components.SchemaVersionV2}
+		log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: io.Discard}),
+			logging.NewExportHandler(client, logging.DefaultExportHandlerConfig))
+
+		log.Log.Info("msg", "count", 3, "small", int8(4), "ratio", float32(0.5), "ids", []int{1, 2})
+
+		r.Len(client.logs, 1)
+		r.Equal(map[string]any{
+			"count": int64(3),
+			"small": int64(4),
+			"ratio": 0.5,
+			"ids":   json.RawMessage(`[1,2]`),
+		}, client.logs[0].Attributes)
+	})
+}
+
+// versionedClient reports a schema version.
+type versionedClient struct {
+	apiClient
+	version string
+}
+
+func (v *versionedClient) SchemaVersion() string {
+	return v.version
+}
+
+func TestExportHandler_EntryMetadata(t *testing.T) {
+	r := require.New(t)
+	client := &apiClient{}
+	log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: io.Discard}),
+		logging.NewExportHandler(client, logging.ExportHandlerConfig{
+			MinLevel:      slog.LevelInfo,
+			Name:          "agent",
+			SchemaVersion: components.SchemaVersionV2,
+		}))
+
+	log.WithField("trace_id", "t-1").WithField("span_id", "s-1").WithField("k", "v").Info("msg1")
+	log.WithGroup("controller").WithField("trace_id", "t-2").Info("msg2")
+
+	r.Len(client.logs, 2)
+	first, second := client.logs[0], client.logs[1]
+	r.Equal("t-1", first.TraceID)
+	r.Equal("s-1", first.SpanID)
+	r.Equal(map[string]string{"k": "v"}, first.Fields, "trace context is not mixed in with fields")
+	r.Equal("agent", first.Logger)
+	r.Equal("agent.controller", second.Logger)
+	r.Empty(second.TraceID, "grouped attrs are not trace context")
+	r.Equal(map[string]string{"controller.trace_id": "t-2"}, second.Fields)
+
+	r.NotNil(first.Source)
+	r.Contains(first.Source.File, "export_handler_test.go")
+	r.Contains(first.Source.Function, "TestExportHandler_EntryMetadata")
+	r.NotZero(first.Source.Line)
+
+	r.NotZero(first.Sequence)
+	r.Greater(second.Sequence, first.Sequence)
+	r.Equal(components.ProcessID(), first.ProcessID)
+}
+
+func TestExportHandler_TraceFieldsV1(t *testing.T) {
+	r := require.New(t)
+	client := &apiClient{}
+	log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: io.Discard}),
+		logging.NewExportHandler(client, logging.DefaultExportHandlerConfig))
+
+	log.WithField("trace_id", "t-1").WithField("span_id", "s-1").Info("msg")
+
+	r.Len(client.logs, 1)
+	r.Equal(map[string]string{"trace_id": "t-1", "span_id": "s-1"}, client.logs[0].Fields, "the v1 endpoint only reads fields")
+}
+
+func TestExportHandler_TraceFromContext(t *testing.T) {
+	r := require.New(t)
+	logging.SetTraceSpanExtractor(staticExtractor{})
+	defer logging.SetTraceSpanExtractor(nil)
+
+	client := &apiClient{}
+	handler := logging.NewExportHandler(client, logging.DefaultExportHandlerConfig)
+	log := slog.New(handler)
+
+	log.InfoContext(context.Background(), "msg")
+
+	r.Len(client.logs, 1)
+	r.Equal("ctx-trace", client.logs[0].TraceID)
+	r.Equal("ctx-span", client.logs[0].SpanID)
+}
+
+func TestExportHandler_IndependentLevel(t *testing.T) {
+	t.Run("should export debug records while console stays at info", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		client := &apiClient{}
+		exportLevel := new(slog.LevelVar)
+		exportLevel.Set(slog.LevelInfo)
+		log := logging.New(
+			logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf, Level: slog.LevelInfo}),
+			logging.NewExportHandler(client, logging.ExportHandlerConfig{Level: exportLevel}),
+		)
+
+		log.Debug("before")
+		r.Empty(client.logs)
+
+		exportLevel.Set(slog.LevelDebug)
+		log.Debug("after")
+		log.Info("info")
+
+		r.Len(client.logs, 2)
+		r.Equal("after", client.logs[0].Message)
+		r.NotContains(buf.String(), "after", "console level is unchanged")
+		r.Contains(buf.String(), "info")
+	})
+
+	t.Run("should ask the next handler once per record", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		log := logging.New(
+			logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf, Level: slog.LevelDebug}),
+			logging.NewRateLimitHandler(logging.RateLimiterHandlerConfig{Limit: rate.Every(time.Hour), Burst: 4}),
+			logging.NewExportHandler(&apiClient{}, logging.ExportHandlerConfig{MinLevel: slog.LevelInfo}),
+		)
+
+		for range 4 {
+			log.Debug("debug")
+		}
+
+		r.Equal(4, strings.Count(buf.String(), "msg=debug"))
+	})
+
+	t.Run("should keep export quieter than console", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		client := &apiClient{}
+		log := logging.New(
+			logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf, Level: slog.LevelDebug}),
+			logging.NewExportHandler(client, logging.ExportHandlerConfig{MinLevel: slog.LevelError}),
+		)
+
+		log.Debug("debug")
+		log.Warn("warn")
+		log.Error("error")
+
+		r.Len(client.logs, 1)
+		r.Equal("error", client.logs[0].Message)
+		r.Contains(buf.String(), "debug")
+		r.Contains(buf.String(), "warn")
+	})
+}
+
+func TestExportHandler_NonBlocking(t *testing.T) {
+	t.Run("should bound blocking exports and report errors through OnError", func(t *testing.T) {
+		r := require.New(t)
+		var exportErr error
+		handler := logging.NewExportHandler(blockingClient{}, logging.ExportHandlerConfig{
+			MinLevel: slog.LevelInfo,
+			Timeout:  20 * time.Millisecond,
+			OnError:  func(err error) { exportErr = err },
+		})
+
+		start := time.Now()
+		err := handler.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+
+		r.NoError(err, "export errors are not returned from Handle")
+		r.Less(time.Since(start), time.Second)
+		r.ErrorIs(exportErr, context.DeadlineExceeded)
+	})
+
+	t.Run("should honor a shorter caller deadline", func(t *testing.T) {
+		r := require.New(t)
+		var exportErr error
+		handler := logging.NewExportHandler(blockingClient{}, logging.ExportHandlerConfig{
+			MinLevel: slog.LevelInfo,
+			Timeout:  time.Minute,
+			OnError:  func(err error) { exportErr = err },
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		r.NoError(handler.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)))
+
+		r.Less(time.Since(start), time.Second)
+		r.ErrorIs(exportErr, context.DeadlineExceeded)
+	})
+
+	t.Run("should export records logged with a cancelled context", func(t *testing.T) {
+		r := require.New(t)
+		client := &ctxClient{}
+		handler := logging.NewExportHandler(client, logging.DefaultExportHandlerConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r.NoError(handler.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, "request cancelled", 0)))
+
+		r.NoError(client.err)
+		r.True(client.hasDeadline)
+	})
+
+	t.Run("should bound exports by default", func(t *testing.T) {
+		r := require.New(t)
+		var exportErr error
+		handler := logging.NewExportHandler(blockingClient{}, logging.ExportHandlerConfig{
+			MinLevel: slog.LevelInfo,
+			OnError:  func(err error) { exportErr = err },
+		})
+
+		start := time.Now()
+		r.NoError(handler.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)))
+
+		r.Less(time.Since(start), time.Second)
+		r.ErrorIs(exportErr, context.DeadlineExceeded)
+	})
+
+	t.Run("should honor the caller deadline without a timeout", func(t *testing.T) {
+		r := require.New(t)
+		client := &ctxClient{}
+		handler := logging.NewExportHandler(client, logging.ExportHandlerConfig{MinLevel: slog.LevelInfo, Timeout: -1})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		r.NoError(handler.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)))
+
+		r.NoError(client.err)
+		r.True(client.hasDeadline)
+	})
+}
+
+// blockingClient blocks until the export context is done.
+type blockingClient struct{}
+
+func (blockingClient) IngestLogs(ctx context.Context, _ []components.Entry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// ctxClient records the state of the export context.
+type ctxClient struct {
+	err         error
+	hasDeadline bool
+}
+
+func (c *ctxClient) IngestLogs(ctx context.Context, _ []components.Entry) error {
+	c.err = ctx.Err()
+	_, c.hasDeadline = ctx.Deadline()
+	return nil
+}
+
+type staticExtractor struct{}
+
+func (staticExtractor) TraceID(context.Context) string { return "ctx-trace" }
+func (staticExtractor) SpanID(context.Context) string  { return "ctx-span" }
+
 type apiClient struct {
 	logs []components.Entry
 }
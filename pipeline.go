@@ -0,0 +1,522 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	"github.com/castai/logging/components"
+)
+
+// PipelineConfig describes a handler chain, see LoadPipeline.
+type PipelineConfig struct {
+	// Base is the format handler writing the records, e.g. text or json.
+	Base HandlerConfig `json:"base" yaml:"base"`
+	// Decorators process records in the listed order before they reach the
+	// sinks and the base handler.
+	Decorators []HandlerConfig `json:"decorators,omitempty" yaml:"decorators"`
+	// Sinks send records to other systems, then pass them on to the base
+	// handler.
+	Sinks []HandlerConfig `json:"sinks,omitempty" yaml:"sinks"`
+}
+
+// HandlerConfig names a registered handler type and its options.
+type HandlerConfig struct {
+	Type    string         `json:"type" yaml:"type"`
+	Options map[string]any `json:"options,omitempty" yaml:"options"`
+}
+
+// HandlerFactory builds a Handler from options. decode fills a typed
+// options struct, rejecting unknown options. A Handler that also has a
+// Close(context.Context) error method is closed by Pipeline.Close.
+type HandlerFactory func(decode func(opts any) error) (Handler, error)
+
+var (
+	handlerFactoriesMu sync.RWMutex
+	handlerFactories   = map[string]HandlerFactory{}
+)
+
+// RegisterHandlerFactory makes a handler type available to pipeline
+// configs, replacing any factory registered under the same name.
+func RegisterHandlerFactory(name string, factory HandlerFactory) {
+	handlerFactoriesMu.Lock()
+	defer handlerFactoriesMu.Unlock()
+	handlerFactories[name] = factory
+}
+
+// RegisterHandler registers a handler type whose options are decoded into
+// T, which is usually a struct with json tags.
+func RegisterHandler[T any](name string, build func(opts T) (Handler, error)) {
+	RegisterHandlerFactory(name, func(decode func(any) error) (Handler, error) {
+		var opts T
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		return build(opts)
+	})
+}
+
+// HandlerTypes returns the names of the registered handler types.
+func HandlerTypes() []string {
+	handlerFactoriesMu.RLock()
+	defer handlerFactoriesMu.RUnlock()
+	names := make([]string, 0, len(handlerFactories))
+	for name := range handlerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pipeline is a Logger built from a PipelineConfig.
+type Pipeline struct {
+	Logger *Logger
+
+	closers []func(context.Context) error
+}
+
+// Close flushes and closes the handlers that need it, e.g. export sinks,
+// and the output file of the base handler, in the reverse build order.
+func (p *Pipeline) Close(ctx context.Context) error {
+	var errs []error
+	for _, closeFn := range slices.Backward(p.closers) {
+		errs = append(errs, closeFn(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadPipeline reads a pipeline config from a JSON or YAML file and builds
+// it. For example:
+//
+//	base:
+//	  type: json
+//	  options: {level: debug, output: stderr}
+//	decorators:
+//	  - type: redact
+//	  - type: rate_limit
+//	    options: {limit: 100, burst: 200}
+//	sinks:
+//	  - type: castai
+//	    options: {env_prefix: CASTAI_, level: warn}
+//
+// Built-in types are text, json and console bases, rate_limit, sampling,
+// timezone, commit, redact and truncate decorators and the castai sink.
+// Errors name the offending config path, e.g. decorators[1].options.burst.
+func LoadPipeline(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("logging: reading pipeline config: %w", err)
+	}
+	cfg, err := ParsePipelineConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewPipeline(cfg)
+}
+
+// ParsePipelineConfig parses a JSON or YAML pipeline config, rejecting
+// unknown fields.
+func ParsePipelineConfig(data []byte) (PipelineConfig, error) {
+	// YAML is a superset of JSON, one decoder handles both.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var cfg PipelineConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return PipelineConfig{}, fmt.Errorf("logging: parsing pipeline config: %w", err)
+	}
+	return cfg, nil
+}
+
+// NewPipeline builds the handler chain described by cfg.
+func NewPipeline(cfg PipelineConfig) (*Pipeline, error) {
+	p := &Pipeline{}
+	build := func(path string, hc HandlerConfig) (Handler, error) {
+		h, err := buildHandler(path, hc)
+		if err != nil {
+			_ = p.Close(context.Background())
+			return nil, err
+		}
+		if c, ok := h.(interface{ Close(context.Context) error }); ok {
+			p.closers = append(p.closers, c.Close)
+		}
+		return h, nil
+	}
+
+	if cfg.Base.Type == "" {
+		return nil, &pipelineError{path: "base.type", err: errors.New("is required")}
+	}
+	base, err := build("base", cfg.Base)
+	if err != nil {
+		return nil, err
+	}
+	handlers := []Handler{base}
+	for i, hc := range cfg.Sinks {
+		h, err := build(fmt.Sprintf("sinks[%d]", i), hc)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+	// The last registered handler runs first.
+	for i := len(cfg.Decorators) - 1; i >= 0; i-- {
+		h, err := build(fmt.Sprintf("decorators[%d]", i), cfg.Decorators[i])
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+
+	p.Logger = &Logger{Log: slog.New(chain(handlers))}
+	return p, nil
+}
+
+func buildHandler(path string, hc HandlerConfig) (Handler, error) {
+	if hc.Type == "" {
+		return nil, &pipelineError{path: path + ".type", err: errors.New("is required")}
+	}
+	handlerFactoriesMu.RLock()
+	factory, ok := handlerFactories[hc.Type]
+	handlerFactoriesMu.RUnlock()
+	if !ok {
+		return nil, &pipelineError{
+			path: path + ".type",
+			err:  fmt.Errorf("unknown handler type %q, expected one of %s", hc.Type, strings.Join(HandlerTypes(), ", ")),
+		}
+	}
+
+	optionsPath := path + ".options"
+	decode := func(opts any) error {
+		data, err := json.Marshal(hc.Options)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(opts)
+	}
+	h, err := factory(decode)
+	if err != nil {
+		return nil, optionsError(optionsPath, err)
+	}
+	return h, nil
+}
+
+// pipelineError is an error in the pipeline config at path.
+type pipelineError struct {
+	path string
+	err  error
+}
+
+func (e *pipelineError) Error() string {
+	return fmt.Sprintf("logging: pipeline config %s: %v", e.path, e.err)
+}
+
+func (e *pipelineError) Unwrap() error {
+	return e.err
+}
+
+// optionsError points decoding errors to the offending option.
+func optionsError(path string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return &pipelineError{path: path, err: fmt.Errorf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &pipelineError{path: path + "." + strings.Trim(field, `"`), err: errors.New("unknown option")}
+	}
+	var optErr *optionError
+	if errors.As(err, &optErr) {
+		return &pipelineError{path: path + "." + optErr.option, err: optErr.err}
+	}
+	return &pipelineError{path: path, err: err}
+}
+
+// optionError is returned by built-in factories for an invalid option
+// value.
+type optionError struct {
+	option string
+	err    error
+}
+
+func (e *optionError) Error() string {
+	return e.option + ": " + e.err.Error()
+}
+
+// parseDurationOption parses a duration option such as "5s", returning 0
+// when it's empty.
+func parseDurationOption(option, v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, &optionError{option: option, err: fmt.Errorf("expected a duration such as \"5s\", got %q", v)}
+	}
+	return d, nil
+}
+
+// parseLevelOption parses a level option such as "warn", returning
+// slog.LevelInfo when it's empty.
+func parseLevelOption(option, v string) (slog.Level, error) {
+	var level slog.Level
+	if v == "" {
+		return level, nil
+	}
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		return 0, &optionError{option: option, err: fmt.Errorf("expected debug, info, warn or error, got %q", v)}
+	}
+	return level, nil
+}
+
+type formatOptions struct {
+	Level     string `json:"level"`  // debug, info, warn or error.
+	Output    string `json:"output"` // stdout, stderr or a file path.
+	AddSource bool   `json:"add_source"`
+	NoColor   bool   `json:"no_color"` // Console only.
+}
+
+// newFormatHandler opens the output of a base format handler. A file is
+// closed with the pipeline.
+func newFormatHandler(opts formatOptions, build func(level slog.Level, out io.Writer, isFile bool) Handler) (Handler, error) {
+	level, err := parseLevelOption("level", opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	out, isFile, err := openOutput(opts.Output)
+	if err != nil {
+		return nil, &optionError{option: "output", err: err}
+	}
+	h := build(level, out, isFile)
+	if f, ok := out.(io.Closer); ok && isFile {
+		return &fileOutputHandler{Handler: h, file: f}, nil
+	}
+	return h, nil
+}
+
+// fileOutputHandler is a base handler writing to a file it owns.
+type fileOutputHandler struct {
+	Handler
+	file io.Closer
+}
+
+func (h *fileOutputHandler) Close(context.Context) error {
+	return h.file.Close()
+}
+
+type rateLimitOptions struct {
+	Limit float64 `json:"limit"`
+	Burst int     `json:"burst"`
+}
+
+type samplingOptions struct {
+	Tick       string `json:"tick"` // A duration such as "1s".
+	First      int    `json:"first"`
+	Thereafter int    `json:"thereafter"`
+}
+
+type timeZoneOptions struct {
+	Location string `json:"location"`
+}
+
+type commitOptions struct {
+	Revision string `json:"revision"`
+}
+
+type redactOptions struct {
+	Keys        []string `json:"keys"`     // Defaults to DefaultRedactKeys.
+	Patterns    []string `json:"patterns"` // Regular expressions, defaults to DefaultRedactPatterns.
+	Strategy    string   `json:"strategy"` // replace, hash or partial.
+	Replacement string   `json:"replacement"`
+}
+
+type truncateOptions struct {
+	MaxMessageLength *int `json:"max_message_length"`
+	MaxValueBytes    *int `json:"max_value_bytes"`
+	MaxAttrs         *int `json:"max_attrs"`
+	MaxDepth         *int `json:"max_depth"`
+}
+
+type castaiSinkOptions struct {
+	// EnvPrefix of the variables read by components.ConfigFromEnv and
+	// components.BatchOptionsFromEnv, defaults to CASTAI_. Keeping the
+	// endpoint and credentials in the environment keeps secrets out of the
+	// config file.
+	EnvPrefix string `json:"env_prefix"`
+	Level     string `json:"level"` // debug, info, warn or error.
+	Name      string `json:"name"`
+	Timeout   string `json:"timeout"` // A duration such as "200ms".
+}
+
+func init() {
+	RegisterHandler("text", func(opts formatOptions) (Handler, error) {
+		return newFormatHandler(opts, func(level slog.Level, out io.Writer, _ bool) Handler {
+			return NewTextHandler(TextHandlerConfig{Level: level, Output: out, AddSource: opts.AddSource})
+		})
+	})
+	RegisterHandler("json", func(opts formatOptions) (Handler, error) {
+		return newFormatHandler(opts, func(level slog.Level, out io.Writer, _ bool) Handler {
+			return NewJSONHandler(JSONHandlerConfig{Level: level, Output: out, AddSource: opts.AddSource})
+		})
+	})
+	RegisterHandler("console", func(opts formatOptions) (Handler, error) {
+		return newFormatHandler(opts, func(level slog.Level, out io.Writer, isFile bool) Handler {
+			return NewConsoleHandler(ConsoleHandlerConfig{
+				Level:     level,
+				Output:    out,
+				AddSource: opts.AddSource,
+				NoColor:   opts.NoColor || isFile,
+			})
+		})
+	})
+	RegisterHandler("rate_limit", func(opts rateLimitOptions) (Handler, error) {
+		cfg := DefaultRateLimitHandlerConfig
+		if opts.Limit < 0 {
+			return nil, &optionError{option: "limit", err: errors.New("must not be negative")}
+		}
+		if opts.Limit > 0 {
+			cfg.Limit = rate.Limit(opts.Limit)
+		}
+		if opts.Burst > 0 {
+			cfg.Burst = opts.Burst
+		}
+		return NewRateLimitHandler(cfg), nil
+	})
+	RegisterHandler("sampling", func(opts samplingOptions) (Handler, error) {
+		cfg := DefaultSamplingHandlerConfig
+		tick, err := parseDurationOption("tick", opts.Tick)
+		if err != nil {
+			return nil, err
+		}
+		if tick > 0 {
+			cfg.Tick = tick
+		}
+		if opts.First > 0 {
+			cfg.First = opts.First
+		}
+		if opts.Thereafter > 0 {
+			cfg.Thereafter = opts.Thereafter
+		}
+		return NewSamplingHandler(cfg), nil
+	})
+	RegisterHandler("timezone", func(opts timeZoneOptions) (Handler, error) {
+		if opts.Location == "" {
+			return nil, &optionError{option: "location", err: errors.New("is required")}
+		}
+		loc, err := time.LoadLocation(opts.Location)
+		if err != nil {
+			return nil, &optionError{option: "location", err: err}
+		}
+		return NewTimeZoneHandler(loc), nil
+	})
+	RegisterHandler("commit", func(opts commitOptions) (Handler, error) {
+		return NewCommitHandler(opts.Revision), nil
+	})
+	RegisterHandler("redact", func(opts redactOptions) (Handler, error) {
+		cfg := DefaultRedactConfig
+		if opts.Keys != nil {
+			cfg.Keys = opts.Keys
+		}
+		if opts.Patterns != nil {
+			cfg.Patterns = make([]*regexp.Regexp, len(opts.Patterns))
+			for i, p := range opts.Patterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return nil, &optionError{option: fmt.Sprintf("patterns[%d]", i), err: err}
+				}
+				cfg.Patterns[i] = re
+			}
+		}
+		switch opts.Strategy {
+		case "", "replace":
+			cfg.Strategy = RedactReplace
+		case "hash":
+			cfg.Strategy = RedactHash
+		case "partial":
+			cfg.Strategy = RedactPartial
+		default:
+			return nil, &optionError{option: "strategy", err: fmt.Errorf("unknown strategy %q, expected replace, hash or partial", opts.Strategy)}
+		}
+		cfg.Replacement = opts.Replacement
+		return NewRedactHandler(cfg), nil
+	})
+	RegisterHandler("truncate", func(opts truncateOptions) (Handler, error) {
+		cfg := DefaultTruncateHandlerConfig
+		for _, o := range []struct {
+			value *int
+			field *int
+		}{
+			{opts.MaxMessageLength, &cfg.MaxMessageLength},
+			{opts.MaxValueBytes, &cfg.MaxValueBytes},
+			{opts.MaxAttrs, &cfg.MaxAttrs},
+			{opts.MaxDepth, &cfg.MaxDepth},
+		} {
+			if o.value != nil {
+				*o.field = *o.value
+			}
+		}
+		return NewTruncateHandler(cfg), nil
+	})
+	RegisterHandler("castai", newCastaiSink)
+}
+
+// castaiSink is an ExportHandler batching to the CAST AI API, closed with
+// the pipeline.
+type castaiSink struct {
+	*ExportHandler
+	client *components.BatchClient
+}
+
+func (s *castaiSink) Close(ctx context.Context) error {
+	return s.client.Close(ctx)
+}
+
+func newCastaiSink(opts castaiSinkOptions) (Handler, error) {
+	timeout, err := parseDurationOption("timeout", opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	level, err := parseLevelOption("level", opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	prefix := opts.EnvPrefix
+	if prefix == "" {
+		prefix = "CASTAI_"
+	}
+	apiClient, err := components.NewAPIClientFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	batchOpts, err := components.BatchOptionsFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	client := components.NewBatchClient(apiClient, batchOpts...)
+	if err := client.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	cfg := DefaultExportHandlerConfig
+	cfg.MinLevel = level
+	cfg.Name = opts.Name
+	if timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return &castaiSink{ExportHandler: NewExportHandler(client, cfg), client: client}, nil
+}
@@ -0,0 +1,217 @@
+package logging_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging"
+)
+
+func TestPipeline(t *testing.T) {
+	readRecords := func(t *testing.T, path string) []map[string]any {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var records []map[string]any
+		for line := range strings.SplitSeq(strings.TrimSpace(string(data)), "\n") {
+			var rec map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &rec))
+			records = append(records, rec)
+		}
+		return records
+	}
+
+	t.Run("should build the handler chain from a YAML file", func(t *testing.T) {
+		r := require.New(t)
+		dir := t.TempDir()
+		out := filepath.Join(dir, "app.log")
+		config := filepath.Join(dir, "logging.yaml")
+		r.NoError(os.WriteFile(config, []byte(`
+base:
+  type: json
+  options:
+    level: debug
+    output: `+out+`
+decorators:
+  - type: redact
+    options:
+      strategy: replace
+  - type: sampling
+    options: {first: 2, thereafter: 0, tick: 1h}
+  - type: commit
+    options: {revision: 0123456789abcdef}
+`), 0o600))
+
+		p, err := logging.LoadPipeline(config)
+		r.NoError(err)
+		for range 5 {
+			p.Logger.Log.Debug("repeated", "password", "hunter2")
+		}
+		r.NoError(p.Close(context.Background()))
+
+		records := readRecords(t, out)
+		r.Len(records, 2)
+		r.Equal("DEBUG", records[0]["level"])
+		r.Equal("[REDACTED]", records[0]["password"])
+		r.Equal("01234567", records[0]["commit"])
+	})
+
+	t.Run("should parse JSON configs", func(t *testing.T) {
+		r := require.New(t)
+		out := filepath.Join(t.TempDir(), "app.log")
+		cfg, err := logging.ParsePipelineConfig([]byte(`{
+			"base": {"type": "json", "options": {"output": "` + out + `"}},
+			"decorators": [{"type": "truncate", "options": {"max_message_length": 4}}]
+		}`))
+		r.NoError(err)
+
+		p, err := logging.NewPipeline(cfg)
+		r.NoError(err)
+		p.Logger.Debug("dropped by level")
+		p.Logger.Info("too long")
+
+		records := readRecords(t, out)
+		r.Len(records, 1)
+		r.True(strings.HasPrefix(records[0]["msg"].(string), "too "))
+		r.Equal(true, records[0]["truncated"])
+	})
+
+	t.Run("should run decorators in the listed order", func(t *testing.T) {
+		r := require.New(t)
+		var order []string
+		for _, name := range []string{"first", "second"} {
+			logging.RegisterHandler("test_"+name, func(struct{}) (logging.Handler, error) {
+				return &orderHandler{name: name, order: &order}, nil
+			})
+		}
+
+		p, err := logging.NewPipeline(logging.PipelineConfig{
+			Base: logging.HandlerConfig{Type: "text", Options: map[string]any{"output": filepath.Join(t.TempDir(), "app.log")}},
+			Decorators: []logging.HandlerConfig{
+				{Type: "test_first"},
+				{Type: "test_second"},
+			},
+		})
+		r.NoError(err)
+		p.Logger.Info("message")
+		r.Equal([]string{"first", "second"}, order)
+		r.Contains(logging.HandlerTypes(), "test_first")
+	})
+
+	t.Run("should name the offending config path in errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			config string
+			errMsg string
+		}{
+			{
+				name:   "missing base",
+				config: `decorators: [{type: redact}]`,
+				errMsg: "logging: pipeline config base.type: is required",
+			},
+			{
+				name:   "unknown type",
+				config: "base: {type: text}\ndecorators: [{type: redact}, {type: nope}]",
+				errMsg: `logging: pipeline config decorators[1].type: unknown handler type "nope"`,
+			},
+			{
+				name:   "wrong option type",
+				config: "base: {type: text}\ndecorators: [{type: redact}, {type: rate_limit, options: {burst: lots}}]",
+				errMsg: "logging: pipeline config decorators[1].options.burst: expected int, got string",
+			},
+			{
+				name:   "unknown option",
+				config: "base: {type: json, options: {colour: true}}",
+				errMsg: "logging: pipeline config base.options.colour: unknown option",
+			},
+			{
+				name:   "invalid option value",
+				config: "base: {type: text}\ndecorators: [{type: redact, options: {patterns: ['[']}}]",
+				errMsg: "logging: pipeline config decorators[0].options.patterns[0]: error parsing regexp",
+			},
+			{
+				name:   "invalid level",
+				config: "base: {type: json, options: {level: loud}}",
+				errMsg: `logging: pipeline config base.options.level: expected debug, info, warn or error, got "loud"`,
+			},
+			{
+				name:   "invalid duration",
+				config: "base: {type: text}\ndecorators: [{type: sampling, options: {tick: soon}}]",
+				errMsg: `logging: pipeline config decorators[0].options.tick: expected a duration such as "5s", got "soon"`,
+			},
+			{
+				name:   "sink without env",
+				config: "base: {type: text}\nsinks: [{type: castai, options: {env_prefix: PIPELINE_TEST_}}]",
+				errMsg: "logging: pipeline config sinks[0].options: field APIBaseURL is required: set PIPELINE_TEST_API_URL",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := require.New(t)
+				cfg, err := logging.ParsePipelineConfig([]byte(tt.config))
+				r.NoError(err)
+				_, err = logging.NewPipeline(cfg)
+				r.ErrorContains(err, tt.errMsg)
+			})
+		}
+	})
+
+	t.Run("should close opened outputs when the build fails", func(t *testing.T) {
+		r := require.New(t)
+		openFiles := func() int {
+			fds, err := os.ReadDir("/proc/self/fd")
+			if err != nil {
+				t.Skip("listing open files is not supported")
+			}
+			return len(fds)
+		}
+		before := openFiles()
+
+		_, err := logging.NewPipeline(logging.PipelineConfig{
+			Base:       logging.HandlerConfig{Type: "json", Options: map[string]any{"output": filepath.Join(t.TempDir(), "app.log")}},
+			Decorators: []logging.HandlerConfig{{Type: "nope"}},
+		})
+		r.Error(err)
+		r.Equal(before, openFiles())
+	})
+
+	t.Run("should reject unknown config fields", func(t *testing.T) {
+		_, err := logging.ParsePipelineConfig([]byte("base: {type: text}\ndecorator: []"))
+		require.ErrorContains(t, err, "field decorator not found")
+	})
+}
+
+type orderHandler struct {
+	name  string
+	order *[]string
+	next  slog.Handler
+}
+
+func (h *orderHandler) Register(next slog.Handler) slog.Handler {
+	h.next = next
+	return h
+}
+
+func (h *orderHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *orderHandler) Handle(ctx context.Context, record slog.Record) error {
+	*h.order = append(*h.order, h.name)
+	return h.next.Handle(ctx, record)
+}
+
+func (h *orderHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &orderHandler{name: h.name, order: h.order, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *orderHandler) WithGroup(name string) slog.Handler {
+	return &orderHandler{name: h.name, order: h.order, next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,394 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// RedactStrategy controls how a sensitive value is masked.
+type RedactStrategy int
+
+const (
+	// RedactReplace replaces the whole value with RedactConfig.Replacement.
+	RedactReplace RedactStrategy = iota
+	// RedactHash replaces the value with a short SHA-256 fingerprint, so
+	// equal secrets can still be correlated across log lines.
+	RedactHash
+	// RedactPartial masks all but the last 4 characters.
+	RedactPartial
+)
+
+const defaultRedactReplacement = "[REDACTED]"
+
+// DefaultRedactKeys are attribute key fragments whose values are always masked.
+var DefaultRedactKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"apikey",
+	"authorization",
+	"cookie",
+	"privatekey",
+	"accesskey",
+	"credentials",
+}
+
+// Patterns detecting secrets and PII inside free-form strings.
+var (
+	RedactPatternJWT          = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	RedactPatternAWSAccessKey = regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)
+	RedactPatternEmail        = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+	// RedactPatternCardNumber matches card numbers written in groups of 4
+	// (or 4-6-5 for Amex) separated by spaces or dashes, or as one run of
+	// digits starting with a Visa, Mastercard, Amex, Discover or JCB prefix.
+	// Only matches passing the Luhn checksum are masked.
+	RedactPatternCardNumber = regexp.MustCompile(`\b(?:` +
+		`\d{4}(?: \d{4}){3}|\d{4}(?:-\d{4}){3}|` +
+		`3[47]\d{2} \d{6} \d{5}|3[47]\d{2}-\d{6}-\d{5}|` +
+		`4\d{12}(?:\d{3}){0,2}|5[1-5]\d{14}|2[2-7]\d{14}|3[47]\d{13}|6(?:011|5\d{2})\d{12}|35\d{14}` +
+		`)\b`)
+)
+
+var DefaultRedactPatterns = []*regexp.Regexp{
+	RedactPatternJWT,
+	RedactPatternAWSAccessKey,
+	RedactPatternEmail,
+	RedactPatternCardNumber,
+}
+
+var DefaultRedactConfig = RedactConfig{
+	Keys:     DefaultRedactKeys,
+	Patterns: DefaultRedactPatterns,
+	Strategy: RedactReplace,
+}
+
+type RedactConfig struct {
+	// Keys are matched against attribute keys, including keys inside groups.
+	// Matching is case-insensitive, ignores `_` and `-`, and matches when the
+	// key contains the fragment, so "token" also covers "refresh_token".
+	Keys []string
+	// Patterns are masked inside messages and string attribute values.
+	Patterns    []*regexp.Regexp
+	Strategy    RedactStrategy
+	Replacement string // Used by RedactReplace, defaults to "[REDACTED]".
+}
+
+// Redactor masks sensitive data in records. It is shared by RedactHandler
+// and ExportHandlerConfig.Redactor and is safe for concurrent use.
+type Redactor struct {
+	keys        []string
+	patterns    []*regexp.Regexp
+	strategy    RedactStrategy
+	replacement string
+	count       atomic.Uint64
+}
+
+func NewRedactor(cfg RedactConfig) *Redactor {
+	keys := make([]string, 0, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		if k = normalizeRedactKey(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	replacement := cfg.Replacement
+	if replacement == "" {
+		replacement = defaultRedactReplacement
+	}
+	return &Redactor{
+		keys:        keys,
+		patterns:    cfg.Patterns,
+		strategy:    cfg.Strategy,
+		replacement: replacement,
+	}
+}
+
+// Count returns the number of values masked so far.
+func (r *Redactor) Count() uint64 {
+	return r.count.Load()
+}
+
+// RedactString masks every pattern match in s.
+func (r *Redactor) RedactString(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllStringFunc(s, func(match string) string {
+			if p == RedactPatternCardNumber && !luhnValid(match) {
+				return match
+			}
+			return r.mask(match)
+		})
+	}
+	return s
+}
+
+// RedactAttr masks attr's value when its key is sensitive, and pattern
+// matches inside string values otherwise. Groups, maps and structs are
+// redacted recursively and LogValuer values are resolved first. A map or
+// struct with masked values is replaced by a map[string]any keyed by map
+// keys or JSON field names.
+func (r *Redactor) RedactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if r.sensitiveKey(attr.Key) {
+		attr.Value = slog.StringValue(r.mask(attr.Value.String()))
+		return attr
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.RedactString(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, a := range group {
+			redacted[i] = r.RedactAttr(a)
+		}
+		attr.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			msg := err.Error()
+			if redacted := r.RedactString(msg); redacted != msg {
+				attr.Value = slog.StringValue(redacted)
+			}
+		} else if redacted, ok := r.redactValue(reflect.ValueOf(attr.Value.Any()), 0); ok {
+			attr.Value = slog.AnyValue(redacted)
+		}
+	default:
+	}
+	return attr
+}
+
+// RedactRecord returns a copy of record with its message and attributes
+// redacted.
+func (r *Redactor) RedactRecord(record slog.Record) slog.Record {
+	redacted := slog.NewRecord(record.Time, record.Level, r.RedactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(r.RedactAttr(attr))
+		return true
+	})
+	return redacted
+}
+
+func (r *Redactor) redactAttrs(attrs []slog.Attr) []slog.Attr {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = r.RedactAttr(a)
+	}
+	return redacted
+}
+
+// maxRedactDepth bounds the recursion into nested values, which may be
+// cyclic.
+const maxRedactDepth = 32
+
+// redactValue returns a redacted copy of v and true when anything inside v
+// was masked, or false when v can be logged as is.
+func (r *Redactor) redactValue(v reflect.Value, depth int) (any, bool) {
+	if !v.IsValid() || depth > maxRedactDepth {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		return r.redactValue(v.Elem(), depth+1)
+	case reflect.String:
+		if redacted := r.RedactString(v.String()); redacted != v.String() {
+			return redacted, true
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		var redacted []any
+		for i := range v.Len() {
+			item, ok := r.redactValue(v.Index(i), depth+1)
+			if ok && redacted == nil {
+				redacted = make([]any, v.Len())
+				for j := range i {
+					redacted[j] = v.Index(j).Interface()
+				}
+			}
+			if redacted != nil {
+				if !ok {
+					item = v.Index(i).Interface()
+				}
+				redacted[i] = item
+			}
+		}
+		return redacted, redacted != nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		fields := make(map[string]any, v.Len())
+		var changed bool
+		iter := v.MapRange()
+		for iter.Next() {
+			value, ok := r.redactField(iter.Key().String(), iter.Value(), depth)
+			fields[iter.Key().String()] = value
+			changed = changed || ok
+		}
+		return fields, changed
+	case reflect.Struct:
+		fields := map[string]any{}
+		changed := r.redactStruct(v, fields, depth)
+		return fields, changed
+	default:
+	}
+	return nil, false
+}
+
+// redactStruct adds the exported fields of v to fields under their JSON
+// names, flattening embedded structs like encoding/json, and reports whether
+// any was masked.
+func (r *Redactor) redactStruct(v reflect.Value, fields map[string]any, depth int) bool {
+	var changed bool
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			changed = r.redactStruct(v.Field(i), fields, depth+1) || changed
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := r.redactField(name, v.Field(i), depth)
+		fields[name] = value
+		changed = changed || ok
+	}
+	return changed
+}
+
+// redactField returns the value of a nested map key or struct field, masked
+// when its key is sensitive, and whether it was changed.
+func (r *Redactor) redactField(key string, v reflect.Value, depth int) (any, bool) {
+	if r.sensitiveKey(key) {
+		return r.mask(fmt.Sprint(v.Interface())), true
+	}
+	if redacted, ok := r.redactValue(v, depth+1); ok {
+		return redacted, true
+	}
+	return v.Interface(), false
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	if len(r.keys) == 0 {
+		return false
+	}
+	key = normalizeRedactKey(key)
+	for _, k := range r.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) mask(s string) string {
+	r.count.Add(1)
+	switch r.strategy {
+	case RedactHash:
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	case RedactPartial:
+		runes := []rune(s)
+		if len(runes) <= 4 {
+			return strings.Repeat("*", len(runes))
+		}
+		return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+	default:
+		return r.replacement
+	}
+}
+
+func normalizeRedactKey(key string) string {
+	key = strings.ToLower(key)
+	return strings.NewReplacer("_", "", "-", "").Replace(key)
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+var _ Handler = new(RedactHandler)
+
+// NewRedactHandler returns a chain handler masking secrets and PII in every
+// record before it reaches the handlers registered before it. To redact only
+// what is exported, set ExportHandlerConfig.Redactor instead.
+func NewRedactHandler(cfg RedactConfig) *RedactHandler {
+	return &RedactHandler{redactor: NewRedactor(cfg)}
+}
+
+type RedactHandler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+// Redactions returns the number of values masked so far.
+func (h *RedactHandler) Redactions() uint64 {
+	return h.redactor.Count()
+}
+
+func (h *RedactHandler) Register(next slog.Handler) slog.Handler {
+	h.next = next
+	return h
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next == nil {
+		return true
+	}
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, record slog.Record) error {
+	if h.next == nil {
+		return nil
+	}
+	return h.next.Handle(ctx, h.redactor.RedactRecord(record))
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &RedactHandler{redactor: h.redactor}
+	if h.next != nil {
+		clone.next = h.next.WithAttrs(h.redactor.redactAttrs(attrs))
+	}
+	return clone
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	clone := &RedactHandler{redactor: h.redactor}
+	if h.next != nil {
+		clone.next = h.next.WithGroup(name)
+	}
+	return clone
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var DefaultSamplingHandlerConfig = SamplingHandlerConfig{
+	Tick:       time.Second,
+	First:      100,
+	Thereafter: 100,
+}
+
+// SamplingHandlerConfig sets how many repeated records SamplingHandler
+// passes on. Records are repeated when they have the same level and message.
+type SamplingHandlerConfig struct {
+	Tick       time.Duration // Window the counts are kept for, defaults to 1s.
+	First      int           // Repeated records passed on each tick before sampling starts.
+	Thereafter int           // After First, every Thereafter-th record is passed on, 0 drops them all.
+}
+
+var _ Handler = new(SamplingHandler)
+
+// NewSamplingHandler returns a chain handler that keeps bursts of the same
+// log line from flooding the handlers registered before it, while still
+// passing on a sample of them. Unlike RateLimitHandler, distinct messages
+// don't share a budget.
+func NewSamplingHandler(cfg SamplingHandlerConfig) *SamplingHandler {
+	if cfg.Tick <= 0 {
+		cfg.Tick = DefaultSamplingHandlerConfig.Tick
+	}
+	return &SamplingHandler{
+		cfg:     cfg,
+		state:   &samplingState{counts: make(map[samplingKey]int)},
+		dropped: &atomic.Uint64{},
+	}
+}
+
+type SamplingHandler struct {
+	cfg     SamplingHandlerConfig
+	next    slog.Handler
+	state   *samplingState
+	dropped *atomic.Uint64
+}
+
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+type samplingState struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]int
+}
+
+func (h *SamplingHandler) Register(next slog.Handler) slog.Handler {
+	h.next = next
+	return h
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next == nil {
+		return true
+	}
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if h.next == nil {
+		return nil
+	}
+	if !h.sample(record) {
+		h.dropped.Add(1)
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// sample reports whether record is passed on.
+func (h *SamplingHandler) sample(record slog.Record) bool {
+	now := record.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	s := h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.windowStart) >= h.cfg.Tick {
+		// Drop the counts of the previous window, which also keeps the map
+		// from growing with every distinct message.
+		clear(s.counts)
+		s.windowStart = now
+	}
+	key := samplingKey{level: record.Level, message: record.Message}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= h.cfg.First {
+		return true
+	}
+	return h.cfg.Thereafter > 0 && (n-h.cfg.First)%h.cfg.Thereafter == 0
+}
+
+// Dropped returns the number of records dropped so far.
+func (h *SamplingHandler) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &SamplingHandler{cfg: h.cfg, state: h.state, dropped: h.dropped}
+	if h.next != nil {
+		clone.next = h.next.WithAttrs(attrs)
+	}
+	return clone
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	clone := &SamplingHandler{cfg: h.cfg, state: h.state, dropped: h.dropped}
+	if h.next != nil {
+		clone.next = h.next.WithGroup(name)
+	}
+	return clone
+}
@@ -0,0 +1,64 @@
+package logging_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	t.Run("should pass first records then sample", func(t *testing.T) {
+		r := require.New(t)
+		sampler := logging.NewSamplingHandler(logging.SamplingHandlerConfig{
+			Tick:       time.Hour,
+			First:      2,
+			Thereafter: 3,
+		})
+		var buf bytes.Buffer
+		log := logging.New(logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf}), sampler)
+
+		for i := range 10 {
+			log.WithField("i", strconv.Itoa(i)).Info("repeated")
+		}
+		log.Info("other")
+
+		r.Equal([]string{"i=0", "i=1", "i=4", "i=7", "other"}, sampledLines(buf.String()))
+		r.EqualValues(6, sampler.Dropped())
+	})
+
+	t.Run("should reset counts every tick", func(t *testing.T) {
+		r := require.New(t)
+		var buf bytes.Buffer
+		log := logging.New(
+			logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf}),
+			logging.NewSamplingHandler(logging.SamplingHandlerConfig{Tick: 20 * time.Millisecond, First: 1}),
+		)
+
+		log.Info("repeated")
+		log.Info("repeated")
+		time.Sleep(30 * time.Millisecond)
+		log.Info("repeated")
+
+		r.Equal(2, strings.Count(buf.String(), "repeated"))
+	})
+}
+
+// sampledLines returns the i attribute, or the message when absent, of each
+// line.
+func sampledLines(out string) []string {
+	var res []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if idx := strings.Index(line, " i="); idx >= 0 {
+			res = append(res, strings.Fields(line[idx:])[0])
+			continue
+		}
+		res = append(res, line[strings.LastIndex(line, "=")+1:])
+	}
+	return res
+}
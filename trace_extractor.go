@@ -6,6 +6,12 @@ import (
 	"sync/atomic"
 )
 
+// Attribute keys trace and span IDs are attached under.
+const (
+	traceIDKey = "trace_id"
+	spanIDKey  = "span_id"
+)
+
 // TraceSpanExtractor pulls trace and span IDs out of a context so log
 // entries derived via FromContext can be enriched with `trace_id` and
 // `span_id` fields.
@@ -59,10 +65,10 @@ func attachTraceFields(ctx context.Context, l *Logger) *Logger {
 	}
 	attrs := make([]any, 0, 2)
 	if traceID != "" {
-		attrs = append(attrs, slog.String("trace_id", traceID))
+		attrs = append(attrs, slog.String(traceIDKey, traceID))
 	}
 	if spanID != "" {
-		attrs = append(attrs, slog.String("span_id", spanID))
+		attrs = append(attrs, slog.String(spanIDKey, spanID))
 	}
 	return &Logger{Log: l.Log.With(attrs...), traceAttached: true}
 }
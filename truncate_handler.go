@@ -0,0 +1,330 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Attribute keys added by TruncateHandler.
+const (
+	TruncatedKey    = "truncated"
+	DroppedAttrsKey = "truncated_attrs"
+)
+
+const (
+	truncatedMarker = "...[truncated %d bytes]"
+	depthMarker     = "[truncated: max depth %d]"
+)
+
+var DefaultTruncateHandlerConfig = TruncateHandlerConfig{
+	MaxMessageLength: 16 * 1024,
+	MaxValueBytes:    8 * 1024,
+	MaxAttrs:         128,
+	MaxDepth:         8,
+}
+
+// TruncateHandlerConfig sets the size limits enforced by TruncateHandler.
+// A zero limit disables that check.
+type TruncateHandlerConfig struct {
+	MaxMessageLength int // Max message length in bytes.
+	MaxValueBytes    int // Max length in bytes of a single attribute value, as it would be formatted.
+	MaxAttrs         int // Max number of attributes per record, counting attributes nested in groups and attached with With.
+	MaxDepth         int // Max group nesting depth, deeper groups are replaced with a marker.
+}
+
+var _ Handler = new(TruncateHandler)
+
+// NewTruncateHandler returns a chain handler that keeps oversized records
+// from reaching the handlers registered before it. Truncated messages and
+// values end with a "...[truncated N bytes]" marker, dropped attributes are
+// counted in a truncated_attrs attribute, and every record that was changed
+// gets a truncated=true attribute.
+func NewTruncateHandler(cfg TruncateHandlerConfig) *TruncateHandler {
+	return &TruncateHandler{cfg: cfg}
+}
+
+type TruncateHandler struct {
+	cfg  TruncateHandlerConfig
+	next slog.Handler
+
+	// attached is the number of attributes already attached via WithAttrs.
+	attached int
+	// attachedDropped is the number of attributes dropped by WithAttrs,
+	// reported with the dropped attributes of each record.
+	attachedDropped int
+	// attachedTruncated records whether any attached attribute was truncated.
+	attachedTruncated bool
+}
+
+func (h *TruncateHandler) Register(next slog.Handler) slog.Handler {
+	h.next = next
+	return h
+}
+
+func (h *TruncateHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next == nil {
+		return true
+	}
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *TruncateHandler) Handle(ctx context.Context, record slog.Record) error {
+	if h.next == nil {
+		return nil
+	}
+
+	msg, truncated := truncateString(record.Message, h.cfg.MaxMessageLength)
+	guarded := slog.NewRecord(record.Time, record.Level, msg, record.PC)
+
+	g := h.newGuard()
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		if a, ok := g.attr(attr, 1); ok {
+			attrs = append(attrs, a)
+		}
+		return true
+	})
+	guarded.AddAttrs(attrs...)
+
+	if dropped := h.attachedDropped + g.dropped; dropped > 0 {
+		guarded.AddAttrs(slog.Int(DroppedAttrsKey, dropped))
+	}
+	if truncated || g.truncated || h.attachedTruncated {
+		guarded.AddAttrs(slog.Bool(TruncatedKey, true))
+	}
+	return h.next.Handle(ctx, guarded)
+}
+
+func (h *TruncateHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	g := h.newGuard()
+	guarded := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if a, ok := g.attr(attr, 1); ok {
+			guarded = append(guarded, a)
+		}
+	}
+
+	clone := &TruncateHandler{
+		cfg:               h.cfg,
+		attached:          h.attached + g.used,
+		attachedDropped:   h.attachedDropped + g.dropped,
+		attachedTruncated: h.attachedTruncated || g.truncated,
+	}
+	if h.next != nil {
+		clone.next = h.next.WithAttrs(guarded)
+	}
+	return clone
+}
+
+func (h *TruncateHandler) WithGroup(name string) slog.Handler {
+	clone := &TruncateHandler{
+		cfg:               h.cfg,
+		attached:          h.attached,
+		attachedDropped:   h.attachedDropped,
+		attachedTruncated: h.attachedTruncated,
+	}
+	if h.next != nil {
+		clone.next = h.next.WithGroup(name)
+	}
+	return clone
+}
+
+func (h *TruncateHandler) newGuard() *attrGuard {
+	budget := -1
+	if h.cfg.MaxAttrs > 0 {
+		budget = max(h.cfg.MaxAttrs-h.attached, 0)
+	}
+	return &attrGuard{cfg: h.cfg, budget: budget}
+}
+
+// attrGuard applies the limits to the attributes of a single record or
+// WithAttrs call.
+type attrGuard struct {
+	cfg       TruncateHandlerConfig
+	budget    int // Remaining attributes, -1 for unlimited.
+	used      int
+	dropped   int
+	truncated bool
+}
+
+// attr returns attr within limits, or false if it must be dropped because
+// the attribute budget is used up.
+func (g *attrGuard) attr(attr slog.Attr, depth int) (slog.Attr, bool) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		return g.group(attr, depth)
+	}
+
+	if g.budget == 0 {
+		g.dropped++
+		g.truncated = true
+		return attr, false
+	}
+	if g.budget > 0 {
+		g.budget--
+	}
+	g.used++
+
+	if g.cfg.MaxValueBytes > 0 {
+		if s, ok := truncatableString(attr.Value, g.cfg.MaxValueBytes); ok {
+			if truncated, changed := truncateString(s, g.cfg.MaxValueBytes); changed {
+				attr.Value = slog.StringValue(truncated)
+				g.truncated = true
+			}
+		}
+	}
+	return attr, true
+}
+
+func (g *attrGuard) group(attr slog.Attr, depth int) (slog.Attr, bool) {
+	if g.cfg.MaxDepth > 0 && depth > g.cfg.MaxDepth {
+		g.truncated = true
+		return g.attr(slog.String(attr.Key, fmt.Sprintf(depthMarker, g.cfg.MaxDepth)), depth)
+	}
+
+	members := attr.Value.Group()
+	guarded := make([]slog.Attr, 0, len(members))
+	for _, member := range members {
+		if a, ok := g.attr(member, depth+1); ok {
+			guarded = append(guarded, a)
+		}
+	}
+	if len(guarded) == 0 && len(members) > 0 {
+		return attr, false
+	}
+	attr.Value = slog.GroupValue(guarded...)
+	return attr, true
+}
+
+// truncatableString returns the formatted representation of values that
+// may be longer than limit. Numbers, bools, times and durations have a small
+// bounded size and are left alone, and so are other values whose formatted
+// size is known to fit without formatting them.
+func truncatableString(v slog.Value, limit int) (string, bool) {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String(), true
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error(), true
+		}
+		if n, ok := formattedSizeBound(reflect.ValueOf(v.Any()), limit, 0); ok && n <= limit {
+			return "", false
+		}
+		return fmt.Sprintf("%+v", v.Any()), true
+	default:
+		return "", false
+	}
+}
+
+// formattedSizeBound returns an upper bound of the size of v formatted with
+// %+v, or false when v must be formatted to know, e.g. because it has a
+// String method, or when the bound exceeds limit.
+func formattedSizeBound(v reflect.Value, limit, depth int) (int, bool) {
+	const (
+		nilSize     = len("<nil>")
+		pointerSize = len("0x") + 16
+		numberSize  = 24 // Digits, sign, point and exponent of a float64.
+	)
+	if !v.IsValid() {
+		return nilSize, true
+	}
+	if depth > maxSizeBoundDepth {
+		return 0, false
+	}
+	if v.CanInterface() && hasFormatMethod(v.Type()) {
+		return 0, false
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return numberSize, true
+	case reflect.Complex64, reflect.Complex128:
+		return 2*numberSize + len("(i)"), true
+	case reflect.String:
+		return v.Len(), v.Len() <= limit
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return pointerSize, true
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nilSize, true
+		}
+		if depth > 0 {
+			return pointerSize, true
+		}
+		// A top-level pointer is formatted as & and the value.
+		n, ok := formattedSizeBound(v.Elem(), limit, depth+1)
+		return n + 1, ok
+	case reflect.Interface:
+		if v.IsNil() {
+			return nilSize, true
+		}
+		return formattedSizeBound(v.Elem(), limit, depth+1)
+	case reflect.Slice, reflect.Array:
+		size := len("[]")
+		for i := range v.Len() {
+			n, ok := formattedSizeBound(v.Index(i), limit, depth+1)
+			if size += n + 1; !ok || size > limit {
+				return 0, false
+			}
+		}
+		return size, true
+	case reflect.Map:
+		size := len("map[]")
+		iter := v.MapRange()
+		for iter.Next() {
+			k, ok := formattedSizeBound(iter.Key(), limit, depth+1)
+			if !ok {
+				return 0, false
+			}
+			n, ok := formattedSizeBound(iter.Value(), limit, depth+1)
+			if size += k + n + 2; !ok || size > limit {
+				return 0, false
+			}
+		}
+		return size, true
+	case reflect.Struct:
+		size := len("{}")
+		for i := range v.NumField() {
+			n, ok := formattedSizeBound(v.Field(i), limit, depth+1)
+			if size += len(v.Type().Field(i).Name) + n + 2; !ok || size > limit {
+				return 0, false
+			}
+		}
+		return size, true
+	default:
+		return 0, false
+	}
+}
+
+// maxSizeBoundDepth bounds the recursion of formattedSizeBound.
+const maxSizeBoundDepth = 8
+
+var (
+	errorType     = reflect.TypeFor[error]()
+	stringerType  = reflect.TypeFor[fmt.Stringer]()
+	formatterType = reflect.TypeFor[fmt.Formatter]()
+)
+
+// hasFormatMethod reports whether fmt formats values of t with a method.
+func hasFormatMethod(t reflect.Type) bool {
+	return t.Implements(errorType) || t.Implements(stringerType) || t.Implements(formatterType)
+}
+
+// truncateString cuts s to at most limit bytes on a rune boundary and appends
+// a marker with the number of bytes removed.
+func truncateString(s string, limit int) (string, bool) {
+	if limit <= 0 || len(s) <= limit {
+		return s, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf(truncatedMarker, len(s)-cut), true
+}
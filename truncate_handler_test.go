@@ -0,0 +1,155 @@
+package logging_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/logging"
+)
+
+func TestTruncateHandler(t *testing.T) {
+	t.Run("should leave records within limits untouched", func(t *testing.T) {
+		r := require.New(t)
+		log, hook := newTruncateLogger(logging.DefaultTruncateHandlerConfig)
+
+		log.WithField("k", "v").Info("msg")
+
+		entry := hook.LastEntry()
+		r.Equal("msg", entry.Message)
+		r.Equal(map[string]any{"k": "v"}, entry.Attrs)
+	})
+
+	t.Run("should truncate message and values with markers", func(t *testing.T) {
+		r := require.New(t)
+		log, hook := newTruncateLogger(logging.TruncateHandlerConfig{MaxMessageLength: 5, MaxValueBytes: 4})
+
+		log.WithField("s", "abcdefgh").
+			WithFieldAny("err", errors.New("connection refused")).
+			WithFieldAny("spec", struct{ Name string }{Name: "pod-a"}).
+			WithFieldAny("n", 123456789).
+			Info("hello world")
+
+		entry := hook.LastEntry()
+		r.Equal("hello...[truncated 6 bytes]", entry.Message)
+		r.Equal("abcd...[truncated 4 bytes]", entry.Attrs["s"])
+		r.Equal("conn...[truncated 14 bytes]", entry.Attrs["err"])
+		r.Equal("{Nam...[truncated 8 bytes]", entry.Attrs["spec"])
+		r.EqualValues(123456789, entry.Attrs["n"], "numbers are never truncated")
+		r.Equal(true, entry.Attrs[logging.TruncatedKey])
+	})
+
+	t.Run("should cut on rune boundaries", func(t *testing.T) {
+		r := require.New(t)
+		log, hook := newTruncateLogger(logging.TruncateHandlerConfig{MaxMessageLength: 4})
+
+		log.Info("ąčęė")
+
+		r.Equal("ąč...[truncated 4 bytes]", hook.LastEntry().Message)
+	})
+
+	t.Run("should resolve LogValuer values", func(t *testing.T) {
+		r := require.New(t)
+		log, hook := newTruncateLogger(logging.TruncateHandlerConfig{MaxValueBytes: 3})
+
+		log.WithFieldAny("v", emailValuer("alice@example.com")).Info("msg")
+
+		r.Equal("ali...[truncated 14 bytes]", hook.LastEntry().Attrs["v"])
+	})
+
+	t.Run("should limit total attribute count including attached attributes", func(t *testing.T) {
+		r := require.New(t)
+		log, hook := newTruncateLogger(logging.TruncateHandlerConfig{MaxAttrs: 3})
+
+		log.WithField("a", "1").
+			WithField("b", "2").
+			With("c", "3", "d", "4").
+			Info("msg")
+
+		entry := hook.LastEntry()
+		r.Equal("1", entry.Attrs["a"])
+		r.Equal("2", entry.Attrs["b"])
+		r.Equal("3", entry.Attrs["c"])
+		r.NotContains(entry.Attrs, "d")
+		r.EqualValues(1, entry.Attrs[logging.DroppedAttrsKey])
+		r.Equal(true, entry.Attrs[logging.TruncatedKey])
+	})
+
+	t.Run("should report attributes dropped by With and by the record once", func(t *testing.T) {
+		r := require.New(t)
+		var buf strings.Builder
+		text := slog.NewTextHandler(&buf, nil)
+		log := slog.New(logging.NewTruncateHandler(logging.TruncateHandlerConfig{MaxAttrs: 1}).Register(text))
+
+		log.With("a", "1", "b", "2").Info("msg", "c", "3")
+
+		r.Equal(1, strings.Count(buf.String(), logging.DroppedAttrsKey+"="))
+		r.Contains(buf.String(), logging.DroppedAttrsKey+"=2")
+	})
+
+	t.Run("should count attributes nested in groups", func(t *testing.T) {
+		r := require.New(t)
+		hook := &logging.TestHook{}
+		log := slog.New(logging.NewTruncateHandler(logging.TruncateHandlerConfig{MaxAttrs: 2}).Register(hook))
+
+		log.Info("msg", slog.Group("g", "a", 1, "b", 2, "c", 3))
+
+		entry := hook.LastEntry()
+		r.EqualValues(1, entry.Attrs["g.a"])
+		r.EqualValues(2, entry.Attrs["g.b"])
+		r.NotContains(entry.Attrs, "g.c")
+		r.EqualValues(1, entry.Attrs[logging.DroppedAttrsKey])
+	})
+
+	t.Run("should replace groups nested deeper than max depth", func(t *testing.T) {
+		r := require.New(t)
+		hook := &logging.TestHook{}
+		log := slog.New(logging.NewTruncateHandler(logging.TruncateHandlerConfig{MaxDepth: 2}).Register(hook))
+
+		log.Info("msg", slog.Group("l1", slog.Group("l2", slog.Group("l3", "k", "v")), "x", "y"))
+
+		entry := hook.LastEntry()
+		r.Equal("[truncated: max depth 2]", entry.Attrs["l1.l2.l3"])
+		r.Equal("y", entry.Attrs["l1.x"])
+		r.Equal(true, entry.Attrs[logging.TruncatedKey])
+	})
+
+	t.Run("should not format values that fit the limit", func(t *testing.T) {
+		r := require.New(t)
+		value := struct {
+			IDs  []int
+			Name string
+		}{IDs: []int{1, 2, 3}, Name: "pod-a"}
+		allocs := func(cfg logging.TruncateHandlerConfig) float64 {
+			log := slog.New(logging.NewTruncateHandler(cfg).Register(slog.NewTextHandler(io.Discard, nil)))
+			return testing.AllocsPerRun(100, func() {
+				log.Info("msg", "spec", value)
+			})
+		}
+
+		r.Equal(allocs(logging.TruncateHandlerConfig{}), allocs(logging.TruncateHandlerConfig{MaxValueBytes: 1024}))
+	})
+
+	t.Run("should keep long lines out of the text output", func(t *testing.T) {
+		r := require.New(t)
+		var buf strings.Builder
+		log := logging.New(
+			logging.NewTextHandler(logging.TextHandlerConfig{Output: &buf}),
+			logging.NewTruncateHandler(logging.TruncateHandlerConfig{MaxValueBytes: 16}),
+		)
+
+		log.WithField("spec", strings.Repeat("x", 1<<20)).Info("msg")
+
+		r.Less(buf.Len(), 200)
+		r.Contains(buf.String(), "truncated=true")
+	})
+}
+
+func newTruncateLogger(cfg logging.TruncateHandlerConfig) (*logging.Logger, *logging.TestHook) {
+	hook := &logging.TestHook{}
+	return logging.New(hook, logging.NewTruncateHandler(cfg)), hook
+}